@@ -1,170 +1,280 @@
 package whd
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"strconv"
-	"time"
-
-	"github.com/hashicorp/go-retryablehttp"
 )
 
+// AssetType is a WHD asset type, such as Desktop or Printer.
+type AssetType struct {
+	Id   int    `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"assetType,omitempty"`
+}
+
+// Manufacturer is a WHD asset manufacturer, such as Dell or HP.
+type Manufacturer struct {
+	Id       int    `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Name     string `json:"name,omitempty"`
+	FullName string `json:"fullName,omitempty"`
+}
+
+// Model is a WHD asset model. It belongs to one manufacturer and one asset
+// type.
+type Model struct {
+	Id             int    `json:"id,omitempty"`
+	Type           string `json:"type,omitempty"`
+	Name           string `json:"modelName,omitempty"`
+	ManufacturerId int    `json:"manufacturerId,omitempty"`
+	AssetTypeId    int    `json:"assetTypeId,omitempty"`
+}
+
+// AssetStatus is a WHD asset status, such as Deployed or Retired.
+type AssetStatus struct {
+	Id   int    `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
 func GetAsset(uri string, user User, assetNumber string, asset *[]Asset, sslVerify bool) error {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"Assets", nil)
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAsset(context.Background(), assetNumber, asset)
+}
+
+func (c *Client) GetAsset(ctx context.Context, assetNumber string, asset *[]Asset) error {
+	req, err := c.newRequest(ctx, "GET", "Assets", nil)
 	if err != nil {
 		return err
 	}
 
-	WrapAuth(req, user)
-
 	q := req.URL.Query()
 	q.Add("assetNumber", assetNumber)
 	req.URL.RawQuery = q.Encode()
 
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 30,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 30,
-		}
+	return c.doJSON(req, &asset)
+}
+
+func GetAssetByID(uri string, user User, assetID int, asset *Asset, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAssetByID(context.Background(), assetID, asset)
+}
+
+func (c *Client) GetAssetByID(ctx context.Context, assetID int, asset *Asset) error {
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("Assets/%d", assetID), nil)
+	if err != nil {
+		return err
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	return c.doJSON(req, &asset)
+}
 
-	resp, err := retryclient.Do(req)
+func GetAssets(uri string, user User, qualifier string, limit uint, page uint, asset *[]Asset, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAssets(context.Background(), qualifier, limit, page, asset)
+}
 
+func (c *Client) GetAssets(ctx context.Context, qualifier string, limit uint, page uint, asset *[]Asset) error {
+	req, err := c.newRequest(ctx, "GET", "Assets", nil)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
 		return err
 	}
-	defer resp.Body.Close()
 
-	data, _ := ioutil.ReadAll(resp.Body)
+	if limit == 0 {
+		limit = 25
+	} else if limit > 100 {
+		limit = 100
+	}
 
-	if err = json.Unmarshal(data, &asset); err != nil {
-		log.Printf("error unmarshalling: %s | %s", err, data)
-		return err
+	if page == 0 {
+		page = 1
 	}
 
-	return nil
+	q := req.URL.Query()
+	q.Add("qualifier", qualifier)
+	q.Add("limit", strconv.FormatUint(uint64(limit), 10))
+	q.Add("page", strconv.FormatUint(uint64(page), 10))
+	req.URL.RawQuery = q.Encode()
+
+	return c.doJSON(req, &asset)
 }
 
-func GetAssetByID(uri string, user User, assetID int, asset *Asset, sslVerify bool) error {
-	req, err := retryablehttp.NewRequest("GET",
-		fmt.Sprintf("%s%sAssets/%d", uri, urn, assetID),
-		nil)
-	if err != nil {
-		return err
+func CreateUpdateAsset(uri string, user User, whdAsset Asset, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).CreateUpdateAsset(context.Background(), whdAsset)
+}
+
+// CreateUpdateAsset creates the asset when its Id is 0 and updates it
+// otherwise. Custom fields already set on the asset and missing from
+// whdAsset are kept. Location, Model, Manufacturer, AssetType and AssetStatus
+// are sent by id only.
+func (c *Client) CreateUpdateAsset(ctx context.Context, whdAsset Asset) (int, error) {
+	whdAssetMap := make(map[string]interface{})
+
+	if whdAsset.Id != 0 {
+		var whdAssetCache Asset
+		if err := c.GetAssetByID(ctx, whdAsset.Id, &whdAssetCache); err != nil {
+			return 0, err
+		}
+		whdAsset.CustomFields = keepCustomFields(whdAsset.CustomFields, whdAssetCache.CustomFields)
 	}
 
-	WrapAuth(req, user)
+	// remove custom fields with empty value, unless they are being cleared
+	whdAsset.CustomFields = dropEmptyCustomFields(whdAsset.CustomFields)
 
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	if err := c.validateCustomFieldsFor(ctx, AssetCustomFields, whdAsset.CustomFields, 0, whdAsset.Id == 0); err != nil {
+		return 0, err
+	}
+
+	if whdAsset.Location.Id != 0 {
+		whdAsset.Location = Location{
+			Id:   whdAsset.Location.Id,
+			Type: "Location",
 		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 30,
+	}
+	if whdAsset.Model.Id != 0 {
+		whdAsset.Model = Model{
+			Id:   whdAsset.Model.Id,
+			Type: "Model",
 		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 30,
+	}
+	if whdAsset.Manufacturer.Id != 0 {
+		whdAsset.Manufacturer = Manufacturer{
+			Id:   whdAsset.Manufacturer.Id,
+			Type: "Manufacturer",
+		}
+	}
+	if whdAsset.AssetType.Id != 0 {
+		whdAsset.AssetType = AssetType{
+			Id:   whdAsset.AssetType.Id,
+			Type: "AssetType",
+		}
+	}
+	if whdAsset.AssetStatus.Id != 0 {
+		whdAsset.AssetStatus = AssetStatus{
+			Id:   whdAsset.AssetStatus.Id,
+			Type: "AssetStatus",
 		}
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	interim, _ := json.Marshal(whdAsset)
+	json.Unmarshal(interim, &whdAssetMap)
+
+	whdAssetMap["customFields"] = customFieldsPayload(whdAsset.CustomFields)
+	delete(whdAssetMap, "assetCustomFields")
+
+	// references without an id would clear the asset's values
+	for key, id := range map[string]int{
+		"location":     whdAsset.Location.Id,
+		"model":        whdAsset.Model.Id,
+		"manufacturer": whdAsset.Manufacturer.Id,
+		"assetType":    whdAsset.AssetType.Id,
+		"assetStatus":  whdAsset.AssetStatus.Id,
+	} {
+		if id == 0 {
+			delete(whdAssetMap, key)
+		}
+	}
 
-	resp, err := retryclient.Do(req)
+	assetJsonStr, _ := json.Marshal(whdAssetMap)
+	c.logger.DebugContext(ctx, "JSON sent to WHD", "json", string(assetJsonStr))
+	if whdAsset.Id == 0 {
+		return c.createAsset(ctx, assetJsonStr)
+	} else {
+		return c.updateAsset(ctx, whdAsset.Id, assetJsonStr)
+	}
+}
 
+func (c *Client) createAsset(ctx context.Context, assetJsonStr []byte) (int, error) {
+	req, err := c.newRequest(ctx, "POST", "Assets", assetJsonStr)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return err
+		return 0, err
+	}
+
+	var asset Asset
+	if err := c.doJSON(req, &asset); err != nil {
+		return 0, err
 	}
-	defer resp.Body.Close()
 
-	data, _ := ioutil.ReadAll(resp.Body)
+	return asset.Id, nil
+}
 
-	if err = json.Unmarshal(data, &asset); err != nil {
-		log.Printf("error unmarshalling: %s | %s", err, data)
-		return err
+func (c *Client) updateAsset(ctx context.Context, id int, assetJsonStr []byte) (int, error) {
+	req, err := c.newRequest(ctx, "PUT", fmt.Sprintf("Assets/%d", id), assetJsonStr)
+	if err != nil {
+		return 0, err
+	}
+
+	var asset Asset
+	if err := c.doJSON(req, &asset); err != nil {
+		return 0, err
 	}
 
-	return nil
+	return asset.Id, nil
 }
 
-func GetAssets(uri string, user User, qualifier string, limit uint, page uint, asset *[]Asset, sslVerify bool) error {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"Assets", nil)
+func DeleteAsset(uri string, user User, assetID int, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).DeleteAsset(context.Background(), assetID)
+}
+
+// DeleteAsset deletes asset assetID. Unlike tickets, deleted assets cannot be
+// restored through the API.
+func (c *Client) DeleteAsset(ctx context.Context, assetID int) error {
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("Assets/%d", assetID), nil)
 	if err != nil {
 		return err
 	}
 
-	WrapAuth(req, user)
+	_, err = c.do(req)
+	return err
+}
 
-	if limit == 0 {
-		limit = 25
-	} else if limit > 100 {
-		limit = 100
-	}
+func GetAssetType(uri string, user User, id int, assetType *AssetType, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAssetType(context.Background(), id, assetType)
+}
 
-	if page == 0 {
-		page = 1
+func (c *Client) GetAssetType(ctx context.Context, id int, assetType *AssetType) error {
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("AssetTypes/%d", id), nil)
+	if err != nil {
+		return err
 	}
 
-	q := req.URL.Query()
-	q.Add("qualifier", qualifier)
-	q.Add("limit", strconv.FormatUint(uint64(limit), 10))
-	q.Add("page", strconv.FormatUint(uint64(page), 10))
-	req.URL.RawQuery = q.Encode()
+	return c.doJSON(req, &assetType)
+}
 
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 30,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 30,
-		}
+func GetManufacturer(uri string, user User, id int, manufacturer *Manufacturer, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetManufacturer(context.Background(), id, manufacturer)
+}
+
+func (c *Client) GetManufacturer(ctx context.Context, id int, manufacturer *Manufacturer) error {
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("Manufacturers/%d", id), nil)
+	if err != nil {
+		return err
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	return c.doJSON(req, &manufacturer)
+}
+
+func GetModel(uri string, user User, id int, model *Model, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetModel(context.Background(), id, model)
+}
 
-	resp, err := retryclient.Do(req)
+func (c *Client) GetModel(ctx context.Context, id int, model *Model) error {
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("Models/%d", id), nil)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
 		return err
 	}
-	defer resp.Body.Close()
 
-	data, _ := ioutil.ReadAll(resp.Body)
+	return c.doJSON(req, &model)
+}
+
+func GetAssetStatus(uri string, user User, id int, assetStatus *AssetStatus, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAssetStatus(context.Background(), id, assetStatus)
+}
 
-	if err = json.Unmarshal(data, &asset); err != nil {
-		log.Printf("error unmarshalling: %s | %s", err, data)
+func (c *Client) GetAssetStatus(ctx context.Context, id int, assetStatus *AssetStatus) error {
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("AssetStatuses/%d", id), nil)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return c.doJSON(req, &assetStatus)
 }
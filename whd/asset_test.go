@@ -0,0 +1,158 @@
+package whd_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestCreateUpdateAssetReferences(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	laptop := srv.AddAssetType("Laptop")
+	dell := srv.AddManufacturer("Dell")
+	xps := srv.AddModel("XPS", dell, laptop)
+	deployed := srv.AddAssetStatus("Deployed")
+	c := srv.Client(whd.WithLogger(nil))
+
+	purchased := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	id, err := c.CreateUpdateAsset(ctx, whd.Asset{
+		AssetNumber:  "A-1",
+		Model:        whd.Model{Id: xps},
+		Manufacturer: whd.Manufacturer{Id: dell},
+		AssetType:    whd.AssetType{Id: laptop},
+		AssetStatus:  whd.AssetStatus{Id: deployed},
+		PurchaseDate: &purchased,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an update leaving references and dates out keeps them
+	if _, err := c.CreateUpdateAsset(ctx, whd.Asset{Id: id, SerialNumber: "S-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var asset whd.Asset
+	if err := c.GetAssetByID(ctx, id, &asset); err != nil {
+		t.Fatal(err)
+	}
+	if asset.SerialNumber != "S-1" || asset.Model.Name != "XPS" || asset.Manufacturer.Name != "Dell" ||
+		asset.AssetType.Name != "Laptop" || asset.AssetStatus.Name != "Deployed" {
+		t.Errorf("got %+v, want the references kept", asset)
+	}
+	if asset.PurchaseDate == nil || !asset.PurchaseDate.Equal(purchased) {
+		t.Errorf("got purchase date %v, want %v", asset.PurchaseDate, purchased)
+	}
+	if asset.WarrantyExpiry != nil {
+		t.Errorf("got warranty expiry %v, want none", asset.WarrantyExpiry)
+	}
+}
+
+// Assets linked to a ticket are sent by id only, so a ticket update cannot
+// blank their details.
+func TestCreateUpdateTicketSendsAssetIds(t *testing.T) {
+	var sent map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &sent)
+		w.Write([]byte(`{"id": 1, "type": "JobTicket"}`))
+	}))
+	defer srv.Close()
+
+	c := whd.NewClient(srv.URL, whd.User{Pass: "key", Type: whd.ApiKeyAuth}, whd.WithLogger(nil))
+	ticket := whd.Ticket{Subject: "s", Assets: []whd.Asset{{Id: 4, AssetNumber: "A-4"}, {Id: 5}}}
+	if _, err := c.CreateUpdateTicket(context.Background(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"id":4,"type":"Asset"},{"id":5,"type":"Asset"}]`
+	if got, _ := json.Marshal(sent["assets"]); string(got) != want {
+		t.Errorf("sent assets %s, want %s", got, want)
+	}
+}
+
+func TestAttachDetachAssets(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	a1 := srv.AddAsset(whd.Asset{AssetNumber: "A-1"})
+	a2 := srv.AddAsset(whd.Asset{AssetNumber: "A-2"})
+	a3 := srv.AddAsset(whd.Asset{AssetNumber: "A-3"})
+	id := srv.AddTicket(whd.Ticket{Subject: "s", Assets: []whd.Asset{{Id: a1}}})
+	other := srv.AddTicket(whd.Ticket{Subject: "other", Assets: []whd.Asset{{Id: a2}}})
+	c := srv.Client(whd.WithLogger(nil))
+
+	assetIds := func(ticketId int) []int {
+		t.Helper()
+		ticket, _ := srv.Ticket(ticketId)
+		var ids []int
+		for _, a := range ticket.Assets {
+			ids = append(ids, a.Id)
+		}
+		return ids
+	}
+
+	steps := []struct {
+		name  string
+		apply func() error
+		want  []int
+	}{
+		// a1 is already linked and a2 passed twice, neither is added again
+		{"attach", func() error { return c.AttachAssetsToTicket(ctx, id, a2, a1, a2) }, []int{a1, a2}},
+		{"attach more", func() error { return c.AttachAssetsToTicket(ctx, id, a3) }, []int{a1, a2, a3}},
+		{"detach", func() error { return c.DetachAssetFromTicket(ctx, id, a2) }, []int{a1, a3}},
+		{"detach not linked", func() error { return c.DetachAssetFromTicket(ctx, id, a2) }, []int{a1, a3}},
+	}
+	for _, s := range steps {
+		if err := s.apply(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got := assetIds(id); !slices.Equal(got, s.want) {
+			t.Errorf("%s: got assets %v, want %v", s.name, got, s.want)
+		}
+	}
+	if got := assetIds(other); !slices.Equal(got, []int{a2}) {
+		t.Errorf("got assets %v on the other ticket, want it untouched", got)
+	}
+
+	if err := c.AttachAssetsToTicket(ctx, 99, a1); !errors.Is(err, whd.ErrNotFound) {
+		t.Errorf("attach to a missing ticket: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetTicketsForAsset(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	a1 := srv.AddAsset(whd.Asset{AssetNumber: "A-1"})
+	a2 := srv.AddAsset(whd.Asset{AssetNumber: "A-2"})
+	t1 := srv.AddTicket(whd.Ticket{Subject: "one", Assets: []whd.Asset{{Id: a1}}})
+	srv.AddTicket(whd.Ticket{Subject: "two", Assets: []whd.Asset{{Id: a2}}})
+	t3 := srv.AddTicket(whd.Ticket{Subject: "both", Assets: []whd.Asset{{Id: a2}, {Id: a1}}})
+	c := srv.Client(whd.WithLogger(nil))
+
+	var tickets []whd.Ticket
+	if err := c.GetTicketsForAsset(context.Background(), a1, 10, 1, &tickets); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, ticket := range tickets {
+		ids = append(ids, ticket.Id)
+	}
+	if !slices.Equal(ids, []int{t1, t3}) {
+		t.Errorf("got tickets %v, want %v", ids, []int{t1, t3})
+	}
+}
@@ -1,10 +1,12 @@
 package whd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"net/http"
+	"os"
+	"strings"
 
 	"github.com/hashicorp/go-retryablehttp"
 )
@@ -25,8 +27,16 @@ type User struct {
 	Type authType
 }
 
-func WrapAuth(req *retryablehttp.Request, user User) {
+// Authenticator adds credentials to a request sent to WHD. User implements it
+// with the query parameters WHD expects; the other implementations in this
+// package read their secrets when the request is made, and
+// WithProxyAuthenticator layers extra credentials for a reverse proxy on top.
+type Authenticator interface {
+	Apply(req *http.Request) error
+}
 
+// Apply adds user's credentials to the query string of req.
+func (user User) Apply(req *http.Request) error {
 	q := req.URL.Query()
 
 	switch user.Type {
@@ -41,44 +51,237 @@ func WrapAuth(req *retryablehttp.Request, user User) {
 	}
 
 	req.URL.RawQuery = q.Encode()
+	return nil
 }
 
-func GetSessionKey(uri string, user User) (string, error) {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"Session", nil)
+func WrapAuth(req *retryablehttp.Request, user User) {
+	user.Apply(req.Request)
+}
+
+// Secret returns a credential when a request needs it, so that rotated
+// secrets are picked up without rebuilding the Client.
+type Secret func(ctx context.Context) (string, error)
+
+// StaticSecret returns a Secret that is always s.
+func StaticSecret(s string) Secret {
+	return func(context.Context) (string, error) {
+		return s, nil
+	}
+}
+
+// EnvSecret returns a Secret read from environment variable name. An unset or
+// empty variable is an error.
+func EnvSecret(name string) Secret {
+	return func(context.Context) (string, error) {
+		v := os.Getenv(name)
+		if v == "" {
+			return "", fmt.Errorf("whd: environment variable %s is not set", name)
+		}
+		return v, nil
+	}
+}
+
+// FileSecret returns a Secret read from the file at path, such as a mounted
+// Kubernetes or Docker secret, with surrounding whitespace trimmed. The file
+// is read for every request.
+func FileSecret(path string) Secret {
+	return func(context.Context) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("whd: reading secret: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+}
+
+// APIKeyAuthenticator authenticates with a WHD API key.
+type APIKeyAuthenticator struct {
+	Key Secret
+}
+
+func (a APIKeyAuthenticator) Apply(req *http.Request) error {
+	key, err := a.Key(req.Context())
 	if err != nil {
-		return "", err
+		return err
+	}
+	return User{Pass: key, Type: ApiKeyAuth}.Apply(req)
+}
+
+// PasswordAuthenticator authenticates as a WHD tech with a password.
+type PasswordAuthenticator struct {
+	Username string
+	Password Secret
+}
+
+func (a PasswordAuthenticator) Apply(req *http.Request) error {
+	password, err := a.Password(req.Context())
+	if err != nil {
+		return err
+	}
+	return User{Name: a.Username, Pass: password, Type: PasswordAuth}.Apply(req)
+}
+
+// SessionKeyAuthenticator authenticates with the key of an open WHD session.
+// Username may be empty.
+type SessionKeyAuthenticator struct {
+	Username   string
+	SessionKey Secret
+}
+
+func (a SessionKeyAuthenticator) Apply(req *http.Request) error {
+	key, err := a.SessionKey(req.Context())
+	if err != nil {
+		return err
 	}
 
-	WrapAuth(req, user)
+	q := req.URL.Query()
+	if a.Username != "" {
+		q.Add("username", a.Username)
+	}
+	q.Add("sessionKey", key)
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
+// BasicAuthenticator sets HTTP basic auth, as asked for by a reverse proxy in
+// front of WHD.
+type BasicAuthenticator struct {
+	Username string
+	Password Secret
+}
 
-	resp, err := retryclient.Do(req)
+func (a BasicAuthenticator) Apply(req *http.Request) error {
+	password, err := a.Password(req.Context())
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return "", err
+		return err
+	}
+	req.SetBasicAuth(a.Username, password)
+	return nil
+}
+
+// HeaderAuthenticator sets header Name to Value, e.g. a proxy token or
+// "Authorization: Bearer ...".
+type HeaderAuthenticator struct {
+	Name  string
+	Value Secret
+}
+
+func (a HeaderAuthenticator) Apply(req *http.Request) error {
+	value, err := a.Value(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(a.Name, value)
+	return nil
+}
+
+// Authenticators applies each of its Authenticators in order.
+type Authenticators []Authenticator
+
+func (as Authenticators) Apply(req *http.Request) error {
+	for _, a := range as {
+		if err := a.Apply(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithAuthenticator makes the Client authenticate to WHD with a instead of
+// the User passed to NewClient.
+func WithAuthenticator(a Authenticator) ClientOption {
+	return func(c *Client) {
+		c.auth = a
+	}
+}
+
+// WithProxyAuthenticator adds the credentials of a to every request the
+// Client sends, including session handling and attachment uploads, on top of
+// the WHD credentials. Use it with BasicAuthenticator or HeaderAuthenticator
+// when WHD sits behind an authenticating reverse proxy.
+func WithProxyAuthenticator(a Authenticator) ClientOption {
+	return func(c *Client) {
+		c.proxyAuth = a
+	}
+}
+
+// isSessionKeyAuth reports whether a authenticates with a session key the
+// caller manages.
+func isSessionKeyAuth(a Authenticator) bool {
+	switch a := a.(type) {
+	case User:
+		return a.Type == SessionKeyAuth
+	case SessionKeyAuthenticator:
+		return true
+	}
+	return false
+}
+
+// authUsername returns the username a logs in with, if it has one.
+func authUsername(a Authenticator) string {
+	switch a := a.(type) {
+	case User:
+		return a.Name
+	case PasswordAuthenticator:
+		return a.Username
+	case SessionKeyAuthenticator:
+		return a.Username
+	}
+	return ""
+}
+
+// applyProxyAuth adds the reverse proxy credentials set with
+// WithProxyAuthenticator to req.
+func (c *Client) applyProxyAuth(req *http.Request) error {
+	if c.proxyAuth == nil {
+		return nil
+	}
+	return c.proxyAuth.Apply(req)
+}
+
+// login adds the Client's own credentials, not a managed session key, to req.
+func (c *Client) login(req *retryablehttp.Request) error {
+	if err := c.auth.Apply(req.Request); err != nil {
+		return fmt.Errorf("whd: applying credentials: %w", err)
 	}
+	return c.applyProxyAuth(req.Request)
+}
 
-	data, _ := ioutil.ReadAll(resp.Body)
+func GetSessionKey(uri string, user User) (string, error) {
+	return NewClient(uri, user).GetSessionKey(context.Background())
+}
+
+// GetSessionKey opens a WHD session with the Client's user and returns its
+// key. The caller terminates it with TerminateSession; see WithSession for a
+// Client that manages its own session.
+func (c *Client) GetSessionKey(ctx context.Context) (string, error) {
+	req, err := c.newLoginRequest(ctx, "GET", "Session", nil)
+	if err != nil {
+		return "", err
+	}
+	if err := c.login(req); err != nil {
+		return "", err
+	}
 
 	var dataMap map[string]interface{}
-	if err := json.Unmarshal(data, &dataMap); err != nil {
-		log.Println("error unmarshalling: ", err)
+	if err := c.doJSON(req, &dataMap); err != nil {
 		return "", err
 	}
 
 	sessionKey, ok := dataMap["sessionKey"].(string)
 	if !ok {
-		log.Println("invalid sessionKey in map")
-		return "", err
+		return "", fmt.Errorf("whd: no sessionKey in Session response")
 	}
 
 	return sessionKey, nil
 }
 
 func TerminateSession(uri string, sessionKey string) error {
-	req, err := retryablehttp.NewRequest("DELETE", uri+urn+"Session", nil)
+	return NewClient(uri, User{}).TerminateSession(context.Background(), sessionKey)
+}
+
+func (c *Client) TerminateSession(ctx context.Context, sessionKey string) error {
+	req, err := retryablehttp.NewRequestWithContext(ctx, "DELETE", c.uri+urn+"Session", nil)
 	if err != nil {
 		return err
 	}
@@ -87,16 +290,21 @@ func TerminateSession(uri string, sessionKey string) error {
 	q.Add("sessionKey", sessionKey)
 	req.URL.RawQuery = q.Encode()
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
+	if err := c.applyProxyAuth(req.Request); err != nil {
+		return err
+	}
 
-	resp, err := retryclient.Do(req)
+	// ending a session must never renew one
+	resp, err := c.streamOnce(req, true)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
 		return err
 	}
+	defer resp.Body.Close()
 
-	data, _ := ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
 
 	if string(data) == "OK" {
 		return nil
@@ -0,0 +1,125 @@
+package whd_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+// Proxy credentials travel in headers on every request, including the upload
+// servlet and the upload session terminate, and never in the query string.
+func TestProxyAuthenticator(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	srv.ProxyHeaders = http.Header{
+		"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("proxy:proxy-pass"))},
+		"X-Proxy-Token": {"proxy-token"},
+	}
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil),
+		whd.WithAuthenticator(whd.APIKeyAuthenticator{Key: whd.StaticSecret(srv.APIKey)}),
+		whd.WithProxyAuthenticator(whd.Authenticators{
+			whd.BasicAuthenticator{Username: "proxy", Password: whd.StaticSecret("proxy-pass")},
+			whd.HeaderAuthenticator{Name: "X-Proxy-Token", Value: whd.StaticSecret("proxy-token")},
+		}))
+
+	var ticket whd.Ticket
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.UploadAttachment(ctx, id, "a.txt", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range srv.Requests() {
+		seen[r.Method+" "+r.Path] = true
+		for name := range srv.ProxyHeaders {
+			if r.Header.Get(name) != srv.ProxyHeaders.Get(name) {
+				t.Errorf("%s %s: got %s %q", r.Method, r.Path, name, r.Header.Get(name))
+			}
+		}
+		for k, vs := range r.Query {
+			for _, v := range vs {
+				if strings.Contains(v, "proxy") {
+					t.Errorf("%s %s: proxy credentials in query parameter %s", r.Method, r.Path, k)
+				}
+			}
+		}
+	}
+	for _, want := range []string{"POST /helpdesk/attachment/upload", "DELETE /helpdesk/WebObjects/Helpdesk.woa/ra/Session"} {
+		if !seen[want] {
+			t.Errorf("no %s request in %v", want, seen)
+		}
+	}
+}
+
+func TestAuthenticatorSecretError(t *testing.T) {
+	errSecret := errors.New("vault sealed")
+	failing := func(context.Context) (string, error) { return "", errSecret }
+
+	tests := []struct {
+		name string
+		opts []whd.ClientOption
+	}{
+		{"credentials", []whd.ClientOption{whd.WithAuthenticator(whd.APIKeyAuthenticator{Key: failing})}},
+		{"proxy credentials", []whd.ClientOption{whd.WithProxyAuthenticator(whd.HeaderAuthenticator{Name: "X-Proxy-Token", Value: failing})}},
+		{"session login", []whd.ClientOption{whd.WithSession(),
+			whd.WithAuthenticator(whd.PasswordAuthenticator{Username: "admin", Password: failing})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			id := srv.AddTicket(whd.Ticket{Subject: "s"})
+			c := srv.Client(append([]whd.ClientOption{whd.WithLogger(nil)}, tt.opts...)...)
+
+			var ticket whd.Ticket
+			if err := c.GetTicket(context.Background(), id, &ticket); !errors.Is(err, errSecret) {
+				t.Errorf("got %v, want the secret error", err)
+			}
+			if n := len(srv.Requests()); n != 0 {
+				t.Errorf("sent %d requests without credentials", n)
+			}
+		})
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("WHD_TEST_KEY", "from-env")
+	if got, err := whd.EnvSecret("WHD_TEST_KEY")(ctx); err != nil || got != "from-env" {
+		t.Errorf("EnvSecret = %q, %v", got, err)
+	}
+	if _, err := whd.EnvSecret("WHD_TEST_UNSET")(ctx); err == nil {
+		t.Error("EnvSecret of an unset variable: got no error")
+	}
+
+	// the file is read again for each request, picking up a rotated secret
+	path := filepath.Join(t.TempDir(), "key")
+	secret := whd.FileSecret(path)
+	for _, key := range []string{"first", "second"} {
+		if err := os.WriteFile(path, []byte(key+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := secret(ctx); err != nil || got != key {
+			t.Errorf("FileSecret = %q, %v, want %q", got, err, key)
+		}
+	}
+	if _, err := whd.FileSecret(filepath.Join(t.TempDir(), "missing"))(ctx); err == nil {
+		t.Error("FileSecret of a missing file: got no error")
+	}
+}
@@ -0,0 +1,298 @@
+package whd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// Client talks to a single Web Help Desk instance. A Client is built once with
+// NewClient and then shared; all of its methods reuse the same connection pool
+// and retry policy, and it is safe for concurrent use.
+//
+// The package level functions (GetTicket, CreateUpdateTicket, ...) are thin
+// wrappers that build a throw-away Client for each call. Clients without TLS
+// options beyond WithSSLVerify share their connections, so those calls do not
+// leave a pool of idle connections behind each.
+type Client struct {
+	uri       string
+	sslVerify bool
+
+	tlsConfig     *tls.Config
+	rootCAs       *x509.CertPool
+	clientCerts   []tls.Certificate
+	minTLSVersion uint16
+
+	timeout     time.Duration
+	retryPolicy RetryPolicy
+	logger      *slog.Logger
+
+	limiter     *tokenBucket
+	maxInFlight int
+	limits      *requestLimits
+
+	httpClient  *http.Client
+	retryClient *retryablehttp.Client
+
+	customFields         *customFieldCache
+	validateCustomFields bool
+
+	auth       Authenticator
+	proxyAuth  Authenticator
+	useSession bool
+	session    *session
+
+	externalKeyField  int
+	closedStatusTypes []int
+	externalKeys      keyedMutex
+}
+
+// ClientOption configures a Client in NewClient.
+type ClientOption func(*Client)
+
+// WithSSLVerify toggles verification of the WHD server certificate. It is
+// enabled by default.
+func WithSSLVerify(sslVerify bool) ClientOption {
+	return func(c *Client) {
+		c.sslVerify = sslVerify
+	}
+}
+
+// WithTimeout sets the timeout of a single HTTP request, including reading the
+// response body. The default is 120 seconds.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetryMax sets how many times a failed request is retried, keeping the
+// rest of the retry policy. The default is the value of RETRY_MAX when the
+// Client is created.
+func WithRetryMax(retry int) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy.MaxAttempts = retry + 1
+	}
+}
+
+// NewClient returns a Client for the WHD instance at uri (scheme and host, e.g.
+// "https://whd.example.com"), authenticating every request as user unless
+// WithAuthenticator says otherwise.
+func NewClient(uri string, user User, opts ...ClientOption) *Client {
+	c := &Client{
+		uri:         uri,
+		sslVerify:   true,
+		timeout:     time.Second * 120,
+		retryPolicy: DefaultRetryPolicy(),
+		logger:      defaultLogger(),
+
+		customFields: &customFieldCache{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.auth == nil {
+		c.auth = user
+	}
+	if c.useSession && !isSessionKeyAuth(c.auth) {
+		c.session = &session{}
+	}
+
+	c.limits = newRequestLimits(c.limiter, c.maxInFlight)
+
+	c.httpClient = &http.Client{
+		Transport: c.newTransport(),
+		Timeout:   c.timeout,
+	}
+	c.retryClient = c.newRetryClient(c.httpClient)
+
+	return c
+}
+
+// sharedTransports are the transports of the Clients without TLS options, by
+// sslVerify.
+var sharedTransports struct {
+	sync.Mutex
+	bySSLVerify map[bool]*http.Transport
+}
+
+// newTransport returns the transport the Client's requests go through. Clients
+// with TLS options get their own; the others share one per sslVerify.
+func (c *Client) newTransport() *http.Transport {
+	if c.hasTLSOptions() {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = c.newTLSConfig()
+		return tr
+	}
+
+	sharedTransports.Lock()
+	defer sharedTransports.Unlock()
+
+	if tr, ok := sharedTransports.bySSLVerify[c.sslVerify]; ok {
+		return tr
+	}
+	if sharedTransports.bySSLVerify == nil {
+		sharedTransports.bySSLVerify = make(map[bool]*http.Transport)
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = c.newTLSConfig()
+	sharedTransports.bySSLVerify[c.sslVerify] = tr
+	return tr
+}
+
+func (c *Client) newRetryClient(client *http.Client) *retryablehttp.Client {
+	retryclient := retryablehttp.NewClient()
+	retryclient.RetryMax = max(c.retryPolicy.MaxAttempts-1, 0)
+	retryclient.RetryWaitMin = c.retryPolicy.MinWait
+	retryclient.RetryWaitMax = c.retryPolicy.MaxWait
+	retryclient.CheckRetry = c.checkRetry
+	retryclient.Backoff = c.backoff
+	retryclient.PrepareRetry = c.limits.prepareRetry
+	retryclient.HTTPClient = client
+	retryclient.Logger = retryLogger{c.logger}
+	// hand back the last response once retries are exhausted, so its status
+	// and body end up in an APIError
+	retryclient.ErrorHandler = retryablehttp.PassthroughErrorHandler
+	return retryclient
+}
+
+// newJarClient returns a retry client sharing the Client's transport that keeps
+// cookies in jar, used by the attachment upload handshake.
+func (c *Client) newJarClient(jar *cookiejar.Jar) *retryablehttp.Client {
+	return c.newRetryClient(&http.Client{
+		Transport: c.httpClient.Transport,
+		Timeout:   c.timeout,
+		Jar:       jar,
+	})
+}
+
+// newRequest builds an authenticated request for resource, relative to the
+// WHD REST root. Cancelling ctx aborts the request and any pending retries.
+func (c *Client) newRequest(ctx context.Context, method string, resource string, body interface{}) (*retryablehttp.Request, error) {
+	req, err := c.newLoginRequest(ctx, method, resource, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.authorize(ctx, req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// newLoginRequest builds a request for resource without credentials.
+func (c *Client) newLoginRequest(ctx context.Context, method string, resource string, body interface{}) (*retryablehttp.Request, error) {
+	req, err := retryablehttp.NewRequestWithContext(withRequestMethod(ctx, method), method, c.uri+urn+resource, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// do sends req and returns the response body. A non-2xx response is returned
+// as an *APIError.
+func (c *Client) do(req *retryablehttp.Request) ([]byte, error) {
+	_, data, err := c.send(req)
+	return data, err
+}
+
+// doJSON sends req and decodes the response body into v. A 2xx response that
+// carries a WHD "reason" is returned as an *APIError.
+func (c *Client) doJSON(req *retryablehttp.Request, v interface{}) error {
+	statusCode, data, err := c.send(req)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		c.logger.ErrorContext(req.Context(), "invalid JSON from WHD",
+			"method", req.Method, "path", req.URL.Path, "error", err)
+		c.logger.DebugContext(req.Context(), "invalid JSON from WHD", "body", string(data))
+		return fmt.Errorf("whd: %s %s: invalid JSON in response: %w", req.Method, req.URL.Path, err)
+	}
+
+	if reason := parseReason(data); reason != "" {
+		return newAPIError(req.Request, statusCode, data)
+	}
+
+	return nil
+}
+
+func (c *Client) send(req *retryablehttp.Request) (int, []byte, error) {
+	resp, err := c.stream(req)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			return apiErr.StatusCode, apiErr.Body, err
+		}
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	return resp.StatusCode, data, nil
+}
+
+// stream sends req and returns the response with its body unread; the caller
+// must close it. A non-2xx response is read, closed and returned as an
+// *APIError.
+func (c *Client) stream(req *retryablehttp.Request) (*http.Response, error) {
+	return c.streamOnce(req, false)
+}
+
+// streamOnce is stream, resending req once with a new session key when the
+// managed session expired and it has not been retried yet.
+func (c *Client) streamOnce(req *retryablehttp.Request, retried bool) (*http.Response, error) {
+	release, err := c.limits.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.retryClient.Do(req)
+	if err != nil {
+		release()
+		c.logRequestFailed(req.Context(), req.Request, err)
+		return nil, redactError(err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		release()
+
+		if !retried && c.sessionExpired(req, resp.StatusCode, data) {
+			if err := c.reauthorize(req); err != nil {
+				return nil, err
+			}
+			return c.streamOnce(req, true)
+		}
+
+		return nil, newAPIError(req.Request, resp.StatusCode, data)
+	}
+
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
@@ -0,0 +1,30 @@
+package whd_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+// The package level functions build a Client per call; they must not leave
+// a connection pool behind each time.
+func TestPackageFunctionsShareConnections(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		var ticket whd.Ticket
+		if err := whd.GetTicket(srv.URL, srv.User(), id, &ticket, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if after := runtime.NumGoroutine(); after-before > 10 {
+		t.Errorf("goroutines went from %d to %d after 50 calls", before, after)
+	}
+}
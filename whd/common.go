@@ -2,6 +2,9 @@ package whd
 
 var RETRY_MAX = 10
 
+// SetRetryMax sets the number of retries of the Clients created afterwards,
+// including the ones built by the package level functions. WithRetryMax and
+// WithRetryPolicy set it per Client.
 func SetRetryMax(retry int) {
 	RETRY_MAX = retry
 }
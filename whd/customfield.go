@@ -0,0 +1,618 @@
+package whd
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CustomFieldSet names the custom field definitions of one kind of record.
+type CustomFieldSet string
+
+const (
+	TicketCustomFields   CustomFieldSet = "CustomFieldDefinitions"
+	LocationCustomFields CustomFieldSet = "CustomFieldDefinitions/Location"
+	AssetCustomFields    CustomFieldSet = "CustomFieldDefinitions/Asset"
+)
+
+// customFieldTimeLayout is the layout date custom fields are sent in, in UTC.
+const customFieldTimeLayout = "2006-01-02T15:04:05Z"
+
+// customFieldTimeLayouts are tried in order when decoding a date custom field.
+var customFieldTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+func parseCustomFieldTime(value string) (time.Time, bool) {
+	for _, layout := range customFieldTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+var (
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	timeType            = reflect.TypeFor[time.Time]()
+)
+
+// Custom field types, as found in CustomFieldDefinition.FieldType.
+const (
+	CustomFieldText     = "TEXT"
+	CustomFieldTextArea = "TEXT_AREA"
+	CustomFieldNumber   = "NUMBER"
+	CustomFieldCheckbox = "CHECKBOX"
+	CustomFieldDate     = "DATE"
+	CustomFieldDropdown = "POPUP_MENU"
+)
+
+// CustomFieldDefinition describes a custom field of tickets, assets or
+// locations.
+type CustomFieldDefinition struct {
+	Id        int    `json:"id,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Label     string `json:"label,omitempty"`
+	FieldType string `json:"fieldType,omitempty"`
+	Required  bool   `json:"required,omitempty"`
+	// Options are the values a dropdown accepts.
+	Options   []string `json:"options,omitempty"`
+	MaxLength int      `json:"maxLength,omitempty"`
+	// RequestTypes restricts a ticket custom field to these request types.
+	// Empty means it applies to every ticket.
+	RequestTypes []RequestType `json:"problemTypes,omitempty"`
+}
+
+func (d CustomFieldDefinition) String() string {
+	return d.Label
+}
+
+// appliesTo reports whether d applies to tickets of request type
+// requestTypeId. An unknown request type (0) matches every definition.
+func (d CustomFieldDefinition) appliesTo(requestTypeId int) bool {
+	if len(d.RequestTypes) == 0 || requestTypeId == 0 {
+		return true
+	}
+	for _, rt := range d.RequestTypes {
+		if rt.Id == requestTypeId {
+			return true
+		}
+	}
+	return false
+}
+
+func GetCustomFieldDefinitions(uri string, user User, set CustomFieldSet, sslVerify bool) ([]CustomFieldDefinition, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetCustomFieldDefinitions(context.Background(), set)
+}
+
+// GetCustomFieldDefinitions reads every custom field definition of set from
+// WHD, and refreshes the Client's cached copy used by DecodeCustomFields,
+// EncodeCustomFields and ValidateCustomFields.
+func (c *Client) GetCustomFieldDefinitions(ctx context.Context, set CustomFieldSet) ([]CustomFieldDefinition, error) {
+	defs, err := c.customFieldDefinitions(ctx, set, true)
+	if err != nil {
+		return nil, err
+	}
+	return append([]CustomFieldDefinition(nil), defs...), nil
+}
+
+// WithCustomFieldValidation makes CreateUpdateTicket, CreateUpdateAsset and
+// CreateUpdateLocation check custom fields against their definitions with
+// ValidateCustomFields before sending them. It is off by default. The
+// definitions are read once and cached by the Client.
+func WithCustomFieldValidation() ClientOption {
+	return func(c *Client) {
+		c.validateCustomFields = true
+	}
+}
+
+// customFieldCache holds the custom field definitions of each CustomFieldSet,
+// read from WHD the first time they are needed.
+type customFieldCache struct {
+	mu   sync.Mutex
+	defs map[CustomFieldSet][]CustomFieldDefinition
+}
+
+// customFieldDefinitions returns the definitions of set, reading them from WHD
+// when they are not cached yet or refresh is set.
+func (c *Client) customFieldDefinitions(ctx context.Context, set CustomFieldSet, refresh bool) ([]CustomFieldDefinition, error) {
+	c.customFields.mu.Lock()
+	defer c.customFields.mu.Unlock()
+
+	if defs, ok := c.customFields.defs[set]; ok && !refresh {
+		return defs, nil
+	}
+
+	defs, err := getResourceListOf[CustomFieldDefinition](ctx, c, string(set), 50, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.customFields.defs == nil {
+		c.customFields.defs = make(map[CustomFieldSet][]CustomFieldDefinition)
+	}
+	c.customFields.defs[set] = defs
+	return defs, nil
+}
+
+// customFieldIds maps every label in wanted onto its definition id. The
+// definitions are read again once if a label is missing, in case it was added
+// since they were cached.
+func (c *Client) customFieldIds(ctx context.Context, set CustomFieldSet, wanted []string) (map[string]int, error) {
+	for refresh := false; ; refresh = true {
+		defs, err := c.customFieldDefinitions(ctx, set, refresh)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make(map[string]int, len(wanted))
+		missing := ""
+		for _, label := range wanted {
+			id, ok := lookupLabel(defs, label)
+			if !ok {
+				missing = label
+				break
+			}
+			ids[label] = id
+		}
+
+		if missing == "" {
+			return ids, nil
+		}
+		if refresh {
+			return nil, fmt.Errorf("whd: no custom field labelled %q in %s: %w", missing, set, ErrNotFound)
+		}
+	}
+}
+
+// lookupLabel finds the definition labelled label in defs, preferring an
+// exact match over a case insensitive one.
+func lookupLabel(defs []CustomFieldDefinition, label string) (int, bool) {
+	found, foundFold := 0, false
+	for _, d := range defs {
+		if d.Label == label {
+			return d.Id, true
+		}
+		if !foundFold && strings.EqualFold(d.Label, label) {
+			found, foundFold = d.Id, true
+		}
+	}
+	return found, foundFold
+}
+
+// ClearCustomField returns a CustomField that blanks custom field id when sent
+// with a CreateUpdate function.
+func ClearCustomField(id int) CustomField {
+	return CustomField{Id: id, Clear: true}
+}
+
+// keepCustomFields appends to cfs the custom fields in current that cfs does
+// not set, so an update does not blank the fields the caller left out.
+func keepCustomFields(cfs []CustomField, current []CustomField) []CustomField {
+	for _, cf := range current {
+		if !slices.ContainsFunc(cfs, func(ncf CustomField) bool { return ncf.Id == cf.Id }) {
+			cfs = append(cfs, cf)
+		}
+	}
+	return cfs
+}
+
+// dropEmptyCustomFields removes the custom fields with an empty value that are
+// not being cleared, as sending them would blank the field in WHD.
+func dropEmptyCustomFields(cfs []CustomField) []CustomField {
+	tempCfs := make([]CustomField, 0, len(cfs))
+	for _, cf := range cfs {
+		if cf.Clear {
+			cf.Value = ""
+		}
+		if cf.Value != "" || cf.Clear {
+			tempCfs = append(tempCfs, cf)
+		}
+	}
+	return tempCfs
+}
+
+// customFieldsPayload returns cfs as sent to WHD under "customFields". The
+// restValue is always present, so a cleared field goes out as "".
+func customFieldsPayload(cfs []CustomField) []map[string]interface{} {
+	if len(cfs) == 0 {
+		return nil
+	}
+
+	payload := make([]map[string]interface{}, 0, len(cfs))
+	for _, cf := range cfs {
+		payload = append(payload, map[string]interface{}{
+			"definitionId": cf.Id,
+			"restValue":    cf.Value,
+		})
+	}
+	return payload
+}
+
+// customFieldTag is a struct field mapped to a custom field by its whd tag.
+type customFieldTag struct {
+	index     int
+	label     string
+	omitEmpty bool
+}
+
+// customFieldTags lists the fields of struct type t carrying a whd tag, as
+// `whd:"Label"` or `whd:"Label,omitempty"`. `whd:"-"` and untagged fields are
+// skipped.
+func customFieldTags(t reflect.Type) ([]customFieldTag, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("whd: custom fields map onto a struct, not %s", t)
+	}
+
+	tags := make([]customFieldTag, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("whd")
+		if !ok || tag == "-" || !f.IsExported() {
+			continue
+		}
+
+		label, opts, _ := strings.Cut(tag, ",")
+		if label == "" {
+			return nil, fmt.Errorf("whd: field %s has an empty custom field label", f.Name)
+		}
+		tags = append(tags, customFieldTag{
+			index:     i,
+			label:     label,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+
+	return tags, nil
+}
+
+func tagLabels(tags []customFieldTag) []string {
+	labels := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		labels = append(labels, tag.label)
+	}
+	return labels
+}
+
+// DecodeCustomFields copies the values of fields, as found on a Ticket, Asset
+// or Location of set, into the struct v points to. Struct fields are matched
+// to custom fields by label with a whd tag:
+//
+//	type Circuit struct {
+//		ID        string    `whd:"Circuit ID"`
+//		Bandwidth int       `whd:"Bandwidth (Mbps)"`
+//		Managed   bool      `whd:"Managed"`
+//		Installed time.Time `whd:"Install Date"`
+//	}
+//
+// Strings (including dropdown values), integers, floats, bools, time.Time,
+// encoding.TextUnmarshaler implementations and pointers to any of them are
+// supported. An empty value sets the zero value, or nil for a pointer; a
+// custom field missing from fields leaves its struct field alone.
+func (c *Client) DecodeCustomFields(ctx context.Context, set CustomFieldSet, fields []CustomField, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("whd: DecodeCustomFields needs a non-nil pointer, not %T", v)
+	}
+	rv = rv.Elem()
+
+	tags, err := customFieldTags(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	ids, err := c.customFieldIds(ctx, set, tagLabels(tags))
+	if err != nil {
+		return err
+	}
+
+	values := make(map[int]string, len(fields))
+	for _, cf := range fields {
+		values[cf.Id] = cf.Value
+	}
+
+	for _, tag := range tags {
+		value, ok := values[ids[tag.label]]
+		if !ok {
+			continue
+		}
+		if err := decodeCustomFieldValue(rv.Field(tag.index), value); err != nil {
+			return fmt.Errorf("whd: custom field %q: %w", tag.label, err)
+		}
+	}
+
+	return nil
+}
+
+// EncodeCustomFields turns the whd tagged fields of the struct v (or pointer
+// to it) into the custom fields of set, ready to be put on a Ticket, Asset or
+// Location. Fields tagged omitempty are left out when they hold their zero
+// value; other fields encoding to "" (an empty string, a nil pointer or a zero
+// time.Time) are marked Clear, so sending them blanks the field. Dates are sent
+// in UTC.
+func (c *Client) EncodeCustomFields(ctx context.Context, set CustomFieldSet, v interface{}) ([]CustomField, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("whd: EncodeCustomFields needs a non-nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+
+	tags, err := customFieldTags(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := c.customFieldIds(ctx, set, tagLabels(tags))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]CustomField, 0, len(tags))
+	for _, tag := range tags {
+		f := rv.Field(tag.index)
+		if tag.omitEmpty && f.IsZero() {
+			continue
+		}
+
+		value, err := encodeCustomFieldValue(f)
+		if err != nil {
+			return nil, fmt.Errorf("whd: custom field %q: %w", tag.label, err)
+		}
+		fields = append(fields, CustomField{Id: ids[tag.label], Value: value, Clear: value == ""})
+	}
+
+	return fields, nil
+}
+
+func decodeCustomFieldValue(f reflect.Value, value string) error {
+	if f.Kind() == reflect.Pointer {
+		if value == "" {
+			f.SetZero()
+			return nil
+		}
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		return decodeCustomFieldValue(f.Elem(), value)
+	}
+
+	if f.Type() == timeType {
+		if value == "" {
+			f.SetZero()
+			return nil
+		}
+		t, ok := parseCustomFieldTime(value)
+		if !ok {
+			return fmt.Errorf("cannot parse %q as a date", value)
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if f.Addr().Type().Implements(textUnmarshalerType) {
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if value == "" {
+		f.SetZero()
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(value), 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(strings.TrimSpace(value), 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		fl, err := strconv.ParseFloat(strings.TrimSpace(value), f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(fl)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+
+	return nil
+}
+
+func encodeCustomFieldValue(f reflect.Value) (string, error) {
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			return "", nil
+		}
+		return encodeCustomFieldValue(f.Elem())
+	}
+
+	if f.Type() == timeType {
+		t := f.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.UTC().Format(customFieldTimeLayout), nil
+	}
+
+	if f.Type().Implements(textMarshalerType) {
+		text, err := f.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		return f.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(f.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(f.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(f.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(f.Float(), 'f', -1, f.Type().Bits()), nil
+	}
+
+	return "", fmt.Errorf("unsupported type %s", f.Type())
+}
+
+// CustomFieldError is a custom field value rejected by ValidateCustomFields.
+type CustomFieldError struct {
+	Id     int
+	Label  string
+	Value  string
+	Reason string
+}
+
+func (e CustomFieldError) Error() string {
+	if e.Label == "" {
+		return fmt.Sprintf("custom field %d: %s", e.Id, e.Reason)
+	}
+	return fmt.Sprintf("custom field %q: %s", e.Label, e.Reason)
+}
+
+// CustomFieldValidationError lists every custom field rejected by
+// ValidateCustomFields. It matches ErrValidation with errors.Is.
+type CustomFieldValidationError struct {
+	Fields []CustomFieldError
+}
+
+func (e *CustomFieldValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Error())
+	}
+	return "whd: invalid custom fields: " + strings.Join(msgs, "; ")
+}
+
+func (e *CustomFieldValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func ValidateCustomFields(uri string, user User, set CustomFieldSet, fields []CustomField, requestTypeId int, create bool, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).ValidateCustomFields(context.Background(), set, fields, requestTypeId, create)
+}
+
+// ValidateCustomFields checks fields against the cached definitions of set:
+// the definition must exist and apply to request type requestTypeId (tickets
+// only, 0 when unknown), the value must fit the field type, dropdown options
+// and maximum length, and a required field may not be blanked. With create,
+// required fields missing from fields are reported too. All problems are
+// returned together as a *CustomFieldValidationError.
+func (c *Client) ValidateCustomFields(ctx context.Context, set CustomFieldSet, fields []CustomField, requestTypeId int, create bool) error {
+	defs, err := c.customFieldDefinitions(ctx, set, false)
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[int]CustomFieldDefinition, len(defs))
+	for _, d := range defs {
+		byId[d.Id] = d
+	}
+
+	var errs []CustomFieldError
+	seen := make(map[int]bool, len(fields))
+	for _, cf := range fields {
+		d, ok := byId[cf.Id]
+		if !ok {
+			errs = append(errs, CustomFieldError{Id: cf.Id, Value: cf.Value, Reason: "no such custom field"})
+			continue
+		}
+		if cf.Value != "" {
+			seen[cf.Id] = true
+		}
+		if reason := d.check(cf.Value, requestTypeId); reason != "" {
+			errs = append(errs, CustomFieldError{Id: cf.Id, Label: d.Label, Value: cf.Value, Reason: reason})
+		}
+	}
+
+	if create {
+		for _, d := range defs {
+			if d.Required && !seen[d.Id] && d.appliesTo(requestTypeId) {
+				errs = append(errs, CustomFieldError{Id: d.Id, Label: d.Label, Reason: "is required"})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &CustomFieldValidationError{Fields: errs}
+	}
+	return nil
+}
+
+// check returns why value is not acceptable for d, or "" if it is.
+func (d CustomFieldDefinition) check(value string, requestTypeId int) string {
+	if !d.appliesTo(requestTypeId) {
+		if value == "" {
+			return ""
+		}
+		return fmt.Sprintf("does not apply to request type %d", requestTypeId)
+	}
+
+	if value == "" {
+		if d.Required {
+			return "is required"
+		}
+		return ""
+	}
+
+	if d.MaxLength > 0 && len([]rune(value)) > d.MaxLength {
+		return fmt.Sprintf("is longer than %d characters", d.MaxLength)
+	}
+
+	switch d.FieldType {
+	case CustomFieldNumber:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return fmt.Sprintf("%q is not a number", value)
+		}
+	case CustomFieldCheckbox:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Sprintf("%q is not true or false", value)
+		}
+	case CustomFieldDate:
+		if _, ok := parseCustomFieldTime(value); !ok {
+			return fmt.Sprintf("%q is not a date", value)
+		}
+	case CustomFieldDropdown:
+		if len(d.Options) > 0 && !slices.Contains(d.Options, value) {
+			return fmt.Sprintf("%q is not one of %s", value, strings.Join(d.Options, ", "))
+		}
+	}
+
+	return ""
+}
+
+// validateCustomFieldsFor runs ValidateCustomFields when the Client was
+// created WithCustomFieldValidation.
+func (c *Client) validateCustomFieldsFor(ctx context.Context, set CustomFieldSet, fields []CustomField, requestTypeId int, create bool) error {
+	if !c.validateCustomFields {
+		return nil
+	}
+	return c.ValidateCustomFields(ctx, set, fields, requestTypeId, create)
+}
@@ -0,0 +1,272 @@
+package whd_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+// customFieldUpdates runs the same custom field update through each
+// CreateUpdate function that merges with the stored record.
+var customFieldUpdates = []struct {
+	name   string
+	create func(srv *whdtest.Server, cfs []whd.CustomField) int
+	update func(ctx context.Context, c *whd.Client, id int, cfs []whd.CustomField) error
+	read   func(ctx context.Context, c *whd.Client, id int) ([]whd.CustomField, error)
+}{
+	{
+		"location",
+		func(srv *whdtest.Server, cfs []whd.CustomField) int {
+			return srv.AddLocation(whd.Location{Name: "ATL", CustomFields: cfs})
+		},
+		func(ctx context.Context, c *whd.Client, id int, cfs []whd.CustomField) error {
+			_, err := c.CreateUpdateLocation(ctx, whd.Location{Id: id, CustomFields: cfs})
+			return err
+		},
+		func(ctx context.Context, c *whd.Client, id int) ([]whd.CustomField, error) {
+			var l whd.Location
+			err := c.GetLocation(ctx, id, &l)
+			return l.CustomFields, err
+		},
+	},
+	{
+		"asset",
+		func(srv *whdtest.Server, cfs []whd.CustomField) int {
+			return srv.AddAsset(whd.Asset{AssetNumber: "A-1", CustomFields: cfs})
+		},
+		func(ctx context.Context, c *whd.Client, id int, cfs []whd.CustomField) error {
+			_, err := c.CreateUpdateAsset(ctx, whd.Asset{Id: id, CustomFields: cfs})
+			return err
+		},
+		func(ctx context.Context, c *whd.Client, id int) ([]whd.CustomField, error) {
+			var a whd.Asset
+			err := c.GetAssetByID(ctx, id, &a)
+			return a.CustomFields, err
+		},
+	},
+	{
+		"requester",
+		func(srv *whdtest.Server, cfs []whd.CustomField) int {
+			return srv.AddRequester(whd.Requester{Username: "jdoe", CustomFields: cfs})
+		},
+		func(ctx context.Context, c *whd.Client, id int, cfs []whd.CustomField) error {
+			_, err := c.CreateUpdateRequester(ctx, whd.Requester{Id: id, CustomFields: cfs})
+			return err
+		},
+		func(ctx context.Context, c *whd.Client, id int) ([]whd.CustomField, error) {
+			var r whd.Requester
+			err := c.GetRequester(ctx, id, &r)
+			return r.CustomFields, err
+		},
+	},
+}
+
+func TestCreateUpdateKeepsCustomFields(t *testing.T) {
+	for _, tt := range customFieldUpdates {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+			ctx := context.Background()
+
+			id := tt.create(srv, []whd.CustomField{{Id: 1, Value: "one"}, {Id: 2, Value: "two"}, {Id: 3, Value: "three"}})
+			c := srv.Client(whd.WithLogger(nil))
+
+			if err := tt.update(ctx, c, id, []whd.CustomField{{Id: 2, Value: "2"}, whd.ClearCustomField(3)}); err != nil {
+				t.Fatal(err)
+			}
+
+			cfs, err := tt.read(ctx, c, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[int]string)
+			for _, cf := range cfs {
+				got[cf.Id] = cf.Value
+			}
+			if got[1] != "one" || got[2] != "2" || got[3] != "" {
+				t.Errorf("got custom fields %v, want 1 kept, 2 updated and 3 cleared", got)
+			}
+		})
+	}
+}
+
+// When the stored record cannot be read, the update is not sent with only the
+// caller's custom fields.
+func TestCreateUpdateReadError(t *testing.T) {
+	for _, tt := range customFieldUpdates {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			id := tt.create(srv, []whd.CustomField{{Id: 1, Value: "one"}})
+			c := srv.Client(whd.WithLogger(nil))
+			srv.Fail(whdtest.Failure{Method: "GET", Times: 1})
+
+			if err := tt.update(context.Background(), c, id, []whd.CustomField{{Id: 2, Value: "2"}}); err == nil {
+				t.Fatal("got no error from the failed read")
+			}
+			for _, r := range srv.Requests() {
+				if r.Method == "PUT" {
+					t.Errorf("sent %s %s after the failed read", r.Method, r.Path)
+				}
+			}
+		})
+	}
+}
+
+type circuit struct {
+	Id        string    `whd:"Circuit ID"`
+	Bandwidth int       `whd:"bandwidth"`
+	Managed   bool      `whd:"Managed"`
+	Installed time.Time `whd:"Install Date,omitempty"`
+	Port      *int      `whd:"Port"`
+	Notes     string
+}
+
+func TestEncodeDecodeCustomFields(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	ids := make(map[string]int)
+	for _, label := range []string{"Circuit ID", "Bandwidth", "Managed", "Install Date"} {
+		ids[label] = srv.AddCustomFieldDefinition(whdtest.CustomFieldDefinitions, label)
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	in := circuit{
+		Id:        "C-1",
+		Bandwidth: 100,
+		Managed:   true,
+		Installed: time.Date(2024, 5, 1, 8, 30, 0, 0, time.FixedZone("EDT", -4*3600)),
+	}
+	if _, err := c.EncodeCustomFields(ctx, whd.TicketCustomFields, in); !errors.Is(err, whd.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound for the missing Port field", err)
+	}
+
+	ids["Port"] = srv.AddCustomFieldDefinition(whdtest.CustomFieldDefinitions, "Port")
+	cfs, err := c.EncodeCustomFields(ctx, whd.TicketCustomFields, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]string{
+		ids["Circuit ID"]:   "C-1",
+		ids["Bandwidth"]:    "100",
+		ids["Managed"]:      "true",
+		ids["Install Date"]: "2024-05-01T12:30:00Z",
+		ids["Port"]:         "",
+	}
+	for _, cf := range cfs {
+		if cf.Value != want[cf.Id] {
+			t.Errorf("custom field %d = %q, want %q", cf.Id, cf.Value, want[cf.Id])
+		}
+	}
+	if len(cfs) != len(want) {
+		t.Errorf("got %d custom fields, want %d", len(cfs), len(want))
+	}
+
+	port := []whd.CustomField{{Id: ids["Port"], Value: "8080"}}
+	var out circuit
+	if err := c.DecodeCustomFields(ctx, whd.TicketCustomFields, append(cfs, port...), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Id != in.Id || out.Bandwidth != in.Bandwidth || !out.Managed || !out.Installed.Equal(in.Installed) ||
+		out.Port == nil || *out.Port != 8080 {
+		t.Errorf("decoded %+v, want %+v with port 8080", out, in)
+	}
+}
+
+func TestValidateCustomFields(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	defs := []whd.CustomFieldDefinition{
+		{Id: 1, Label: "Count", FieldType: whd.CustomFieldNumber},
+		{Id: 2, Label: "Managed", FieldType: whd.CustomFieldCheckbox},
+		{Id: 3, Label: "Due", FieldType: whd.CustomFieldDate},
+		{Id: 4, Label: "Tier", FieldType: whd.CustomFieldDropdown, Options: []string{"Gold", "Silver"}},
+		{Id: 5, Label: "Code", MaxLength: 3},
+		{Id: 6, Label: "Owner", Required: true},
+		{Id: 7, Label: "Circuit", RequestTypes: []whd.RequestType{{Id: 10}}},
+	}
+	for _, d := range defs {
+		srv.Put(whdtest.CustomFieldDefinitions, d)
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	tests := []struct {
+		name          string
+		fields        []whd.CustomField
+		requestTypeId int
+		create        bool
+		want          []int // ids of the rejected fields, in order
+	}{
+		{"valid", []whd.CustomField{
+			{Id: 1, Value: " 2.5"}, {Id: 2, Value: "true"}, {Id: 3, Value: "2024-05-01T12:30:00Z"},
+			{Id: 4, Value: "Gold"}, {Id: 5, Value: "abc"}, {Id: 6, Value: "me"},
+		}, 0, false, nil},
+		{"number", []whd.CustomField{{Id: 1, Value: "two"}}, 0, false, []int{1}},
+		{"checkbox", []whd.CustomField{{Id: 2, Value: "yes"}}, 0, false, []int{2}},
+		{"date", []whd.CustomField{{Id: 3, Value: "tomorrow"}}, 0, false, []int{3}},
+		{"dropdown option", []whd.CustomField{{Id: 4, Value: "Bronze"}}, 0, false, []int{4}},
+		{"max length", []whd.CustomField{{Id: 5, Value: "abcd"}}, 0, false, []int{5}},
+		{"max length in characters", []whd.CustomField{{Id: 5, Value: "äöü"}}, 0, false, nil},
+		{"unknown field", []whd.CustomField{{Id: 99, Value: "x"}}, 0, false, []int{99}},
+		{"required blanked", []whd.CustomField{whd.ClearCustomField(6)}, 0, false, []int{6}},
+		{"required left out on update", nil, 0, false, nil},
+		{"required left out on create", nil, 0, true, []int{6}},
+		{"request type", []whd.CustomField{{Id: 7, Value: "C-1"}}, 10, false, nil},
+		{"other request type", []whd.CustomField{{Id: 7, Value: "C-1"}}, 11, false, []int{7}},
+		{"other request type blank", []whd.CustomField{whd.ClearCustomField(7)}, 11, false, nil},
+		{"every error", []whd.CustomField{{Id: 1, Value: "x"}, {Id: 4, Value: "x"}}, 0, true, []int{1, 4, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.ValidateCustomFields(context.Background(), whd.TicketCustomFields, tt.fields, tt.requestTypeId, tt.create)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+
+			var verr *whd.CustomFieldValidationError
+			if !errors.Is(err, whd.ErrValidation) || !errors.As(err, &verr) {
+				t.Fatalf("got %v, want a CustomFieldValidationError", err)
+			}
+			var got []int
+			for _, f := range verr.Fields {
+				got = append(got, f.Id)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("rejected fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// An invalid custom field stops the write before anything is sent.
+func TestCustomFieldValidationBeforeWrite(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	srv.Put(whdtest.CustomFieldDefinitions, whd.CustomFieldDefinition{Id: 1, Label: "Count", FieldType: whd.CustomFieldNumber})
+	c := srv.Client(whd.WithLogger(nil), whd.WithCustomFieldValidation())
+
+	ticket := whd.Ticket{Subject: "s", CustomFields: []whd.CustomField{{Id: 1, Value: "two"}}}
+	if _, err := c.CreateUpdateTicket(context.Background(), ticket); !errors.Is(err, whd.ErrValidation) {
+		t.Fatalf("got %v, want ErrValidation", err)
+	}
+	for _, r := range srv.Requests() {
+		if r.Method != "GET" {
+			t.Errorf("sent %s %s for an invalid ticket", r.Method, r.Path)
+		}
+	}
+}
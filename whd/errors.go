@@ -0,0 +1,94 @@
+package whd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Sentinel errors to test an *APIError against with errors.Is.
+var (
+	ErrNotFound     = errors.New("whd: not found")
+	ErrUnauthorized = errors.New("whd: unauthorized")
+	ErrValidation   = errors.New("whd: validation failed")
+	ErrConflict     = errors.New("whd: conflicting update")
+)
+
+// APIError is returned when WHD rejects a request, either with an error HTTP
+// status or with a "reason" in the response body.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string // request path, without the query string holding credentials
+	Reason     string // WHD's explanation, when it sent one
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("whd: %s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Reason)
+	}
+	return fmt.Sprintf("whd: %s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is maps the HTTP status onto ErrNotFound, ErrUnauthorized, ErrValidation and
+// ErrConflict.
+// A successful status carrying a reason is WHD refusing the payload, and is
+// treated as a validation error.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest ||
+			e.StatusCode == http.StatusUnprocessableEntity ||
+			(e.StatusCode < 400 && e.Reason != "")
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+func newAPIError(req *http.Request, statusCode int, data []byte) *APIError {
+	return &APIError{
+		StatusCode: statusCode,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Reason:     parseReason(data),
+		Body:       data,
+	}
+}
+
+// parseReason extracts the "reason" WHD puts in error responses. Anything that
+// is not a JSON object with a reason yields "".
+func parseReason(data []byte) string {
+	var r struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return ""
+	}
+	return r.Reason
+}
+
+// ConflictError is returned by UpdateTicketIfUnchanged when the ticket was
+// changed in WHD since the caller read it. It matches ErrConflict with
+// errors.Is.
+type ConflictError struct {
+	Id       int
+	Expected time.Time // LastUpdated of the caller's copy
+	Current  Ticket    // the ticket as it is now in WHD
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("whd: ticket %d was updated at %s, after %s",
+		e.Id, e.Current.LastUpdated.Format(time.RFC3339), e.Expected.Format(time.RFC3339))
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
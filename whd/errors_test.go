@@ -0,0 +1,67 @@
+package whd_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+)
+
+func TestAPIError(t *testing.T) {
+	sentinels := []error{whd.ErrNotFound, whd.ErrUnauthorized, whd.ErrValidation, whd.ErrConflict}
+
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantReason string
+		want       error // the only sentinel matching, nil for none
+	}{
+		{"not found", 404, `{"reason": "No such ticket"}`, "No such ticket", whd.ErrNotFound},
+		{"unauthorized", 401, `{"reason": "Invalid credentials"}`, "Invalid credentials", whd.ErrUnauthorized},
+		{"forbidden", 403, ``, "", whd.ErrUnauthorized},
+		{"bad request", 400, `{"reason": "Subject is required"}`, "Subject is required", whd.ErrValidation},
+		{"unprocessable", 422, `{"reason": "bad date"}`, "bad date", whd.ErrValidation},
+		{"conflict", 409, `{}`, "", whd.ErrConflict},
+		{"reason on success", 200, `{"reason": "Unknown status type"}`, "Unknown status type", whd.ErrValidation},
+		{"server error", 500, `{"reason": "NullPointerException"}`, "NullPointerException", nil},
+		{"html body", 502, `<html>Bad Gateway</html>`, "", nil},
+		{"reason not a string", 400, `{"reason": 12}`, "", whd.ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := whd.NewClient(srv.URL, whd.User{Pass: "secret-key", Type: whd.ApiKeyAuth},
+				whd.WithLogger(nil), whd.WithRetryMax(0))
+			var ticket whd.Ticket
+			err := c.GetTicket(context.Background(), 1, &ticket)
+
+			var apiErr *whd.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Method != "GET" || !strings.HasSuffix(apiErr.Path, "/ra/Ticket/1") ||
+				apiErr.Reason != tt.wantReason || string(apiErr.Body) != tt.body {
+				t.Errorf("got %+v", apiErr)
+			}
+			if strings.Contains(err.Error(), "secret-key") {
+				t.Errorf("error %q holds the API key", err)
+			}
+			for _, s := range sentinels {
+				if got := errors.Is(err, s); got != (s == tt.want) {
+					t.Errorf("errors.Is(%v) = %v", s, got)
+				}
+			}
+		})
+	}
+}
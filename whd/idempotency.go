@@ -0,0 +1,134 @@
+package whd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	whdq "github.com/pvik/go-whd/whd/qualifier"
+)
+
+// WithExternalKeyField sets the ticket custom field, by definition id,
+// CreateTicketOnce stores external keys in.
+func WithExternalKeyField(definitionId int) ClientOption {
+	return func(c *Client) {
+		c.externalKeyField = definitionId
+	}
+}
+
+// WithClosedStatusTypes sets the status types, by id, of closed tickets. A
+// closed ticket does not stop CreateTicketOnce from opening a new one for the
+// same key. Without it only deleted tickets are ignored.
+func WithClosedStatusTypes(statusTypeIds ...int) ClientOption {
+	return func(c *Client) {
+		c.closedStatusTypes = append([]int(nil), statusTypeIds...)
+	}
+}
+
+// keyedMutex serializes work per key, dropping a key's lock once nobody holds
+// or waits for it.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyLock)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func CreateTicketOnce(uri string, user User, keyFieldId int, closedStatusTypeIds []int, externalKey string, whdTicket Ticket, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify), WithExternalKeyField(keyFieldId), WithClosedStatusTypes(closedStatusTypeIds...)).CreateTicketOnce(context.Background(), externalKey, whdTicket)
+}
+
+// CreateTicketOnce creates whdTicket tagged with externalKey, such as an alert
+// id, unless an open ticket with that key already exists, in which case its id
+// is returned and nothing is created. The key is stored in the custom field set
+// with WithExternalKeyField; tickets in a status set with WithClosedStatusTypes
+// are not open. Calls for the same key through the same Client
+// run one at a time; separate processes sharing keys are not coordinated.
+func (c *Client) CreateTicketOnce(ctx context.Context, externalKey string, whdTicket Ticket) (int, error) {
+	if c.externalKeyField == 0 {
+		return 0, fmt.Errorf("whd: CreateTicketOnce needs WithExternalKeyField: %w", ErrValidation)
+	}
+	if externalKey == "" {
+		return 0, fmt.Errorf("whd: CreateTicketOnce needs an external key: %w", ErrValidation)
+	}
+	if whdTicket.Id != 0 {
+		return 0, fmt.Errorf("whd: CreateTicketOnce creates tickets, got ticket %d: %w", whdTicket.Id, ErrValidation)
+	}
+
+	unlock := c.externalKeys.lock(externalKey)
+	defer unlock()
+
+	id, err := c.findTicketByExternalKey(ctx, externalKey)
+	if err != nil {
+		return 0, err
+	}
+	if id != 0 {
+		c.logger.DebugContext(ctx, "ticket for external key already exists", "key", externalKey, "id", id)
+		return id, nil
+	}
+
+	cfs := make([]CustomField, 0, len(whdTicket.CustomFields)+1)
+	for _, cf := range whdTicket.CustomFields {
+		if cf.Id != c.externalKeyField {
+			cfs = append(cfs, cf)
+		}
+	}
+	whdTicket.CustomFields = append(cfs, CustomField{Id: c.externalKeyField, Value: externalKey})
+
+	return c.CreateUpdateTicket(ctx, whdTicket)
+}
+
+// findTicketByExternalKey returns the id of the open ticket tagged with
+// externalKey, or 0 if there is none.
+func (c *Client) findTicketByExternalKey(ctx context.Context, externalKey string) (int, error) {
+	conditions := []whdq.Expr{
+		whdq.Eq("ticketCustomFields.restValue", externalKey),
+		whdq.NotDeleted(),
+	}
+	for _, id := range c.closedStatusTypes {
+		conditions = append(conditions, whdq.Ne("statustype.id", id))
+	}
+	q := whdq.And(conditions...).String()
+
+	for ticket, err := range c.Tickets(ctx, q, IteratorOptions{}) {
+		if err != nil {
+			return 0, err
+		}
+		// the qualifier matches the key in any custom field
+		for _, cf := range ticket.CustomFields {
+			if cf.Id == c.externalKeyField && cf.Value == externalKey {
+				return ticket.Id, nil
+			}
+		}
+	}
+
+	return 0, nil
+}
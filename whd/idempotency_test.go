@@ -0,0 +1,155 @@
+package whd_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestCreateTicketOnce(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	key := srv.AddCustomFieldDefinition(whdtest.CustomFieldDefinitions, "Alert ID")
+	c := srv.Client(whd.WithLogger(nil), whd.WithExternalKeyField(key))
+
+	// the same value in another custom field is not the key
+	srv.AddTicket(whd.Ticket{Subject: "other", CustomFields: []whd.CustomField{{Id: key + 1, Value: "A"}}})
+
+	var wg sync.WaitGroup
+	ids := make([]int, 10)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := c.CreateTicketOnce(ctx, "A", whd.Ticket{Subject: "alert"})
+			if err != nil {
+				t.Error(err)
+			}
+			ids[i] = id
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if id == 0 || id != ids[0] {
+			t.Fatalf("got ids %v, want one ticket", ids)
+		}
+	}
+	ticket, _ := srv.Ticket(ids[0])
+	if ticket.Subject != "alert" {
+		t.Errorf("got ticket %+v, want the alert", ticket)
+	}
+
+	// a deleted ticket no longer holds its key
+	if err := c.DeleteTicket(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.CreateTicketOnce(ctx, "A", whd.Ticket{Subject: "alert"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == ids[0] {
+		t.Error("matched the deleted ticket")
+	}
+}
+
+func TestCreateTicketOnceClosedStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		closed     bool // pass the "Done" status to WithClosedStatusTypes
+		status     string
+		wantReused bool
+	}{
+		{"closed status not set", false, "Done", true},
+		{"closed status", true, "Done", false},
+		{"open status", true, "Open", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			key := srv.AddCustomFieldDefinition(whdtest.CustomFieldDefinitions, "Alert ID")
+			// status names are up to each WHD install
+			statuses := map[string]int{"Done": srv.AddStatusType("Done"), "Open": srv.AddStatusType("Open")}
+			existing := srv.AddTicket(whd.Ticket{
+				Subject:      "existing",
+				StatusType:   whd.StatusType{Id: statuses[tt.status]},
+				CustomFields: []whd.CustomField{{Id: key, Value: "A"}},
+			})
+
+			opts := []whd.ClientOption{whd.WithLogger(nil), whd.WithExternalKeyField(key)}
+			if tt.closed {
+				opts = append(opts, whd.WithClosedStatusTypes(statuses["Done"]))
+			}
+			c := srv.Client(opts...)
+
+			id, err := c.CreateTicketOnce(context.Background(), "A", whd.Ticket{Subject: "alert"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reused := id == existing; reused != tt.wantReused {
+				t.Errorf("got ticket %d, reusing ticket %d: %v, want %v", id, existing, reused, tt.wantReused)
+			}
+		})
+	}
+}
+
+func TestCreateTicketOnceValidation(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		opts   []whd.ClientOption
+		key    string
+		ticket whd.Ticket
+	}{
+		{"no key field", nil, "A", whd.Ticket{}},
+		{"no key", []whd.ClientOption{whd.WithExternalKeyField(1)}, "", whd.Ticket{}},
+		{"existing ticket", []whd.ClientOption{whd.WithExternalKeyField(1)}, "A", whd.Ticket{Id: 3}},
+	}
+
+	for _, tt := range tests {
+		c := srv.Client(append([]whd.ClientOption{whd.WithLogger(nil)}, tt.opts...)...)
+		if _, err := c.CreateTicketOnce(ctx, tt.key, tt.ticket); !errors.Is(err, whd.ErrValidation) {
+			t.Errorf("%s: got %v, want ErrValidation", tt.name, err)
+		}
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("sent %d requests, want none", n)
+	}
+}
+
+func TestCreateTicketOncePackageFunc(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	key := srv.AddCustomFieldDefinition(whdtest.CustomFieldDefinitions, "Alert ID")
+	done := srv.AddStatusType("Done")
+	closed := srv.AddTicket(whd.Ticket{
+		Subject:      "closed",
+		StatusType:   whd.StatusType{Id: done},
+		CustomFields: []whd.CustomField{{Id: key, Value: "A"}},
+	})
+
+	id, err := whd.CreateTicketOnce(srv.URL, srv.User(), key, []int{done}, "A", whd.Ticket{Subject: "alert"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == closed {
+		t.Error("matched the closed ticket")
+	}
+	again, err := whd.CreateTicketOnce(srv.URL, srv.User(), key, nil, "A", whd.Ticket{Subject: "alert"}, true)
+	if err != nil || (again != closed && again != id) {
+		t.Errorf("got %d, %v, want an existing ticket with no closed status types", again, err)
+	}
+}
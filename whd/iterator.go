@@ -0,0 +1,237 @@
+package whd
+
+import (
+	"context"
+	"iter"
+)
+
+// IteratorOptions controls how TicketIterator, AssetIterator and their
+// iter.Seq2 counterparts walk the pages of a query.
+type IteratorOptions struct {
+	// PageSize is the number of items requested per page. It defaults to, and
+	// is capped at, 100.
+	PageSize uint
+	// MaxItems stops the iteration after that many items. Zero means no limit.
+	MaxItems int
+	// Prefetch requests the next page in the background while the current one
+	// is being consumed.
+	Prefetch bool
+}
+
+// TicketIterator walks every ticket matching a qualifier, one page at a time.
+//
+//	it := client.TicketIterator(ctx, qualifier, whd.IteratorOptions{})
+//	defer it.Close()
+//	for it.Next() {
+//		t := it.Ticket()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type TicketIterator struct {
+	p *pager[Ticket]
+}
+
+// TicketIterator returns an iterator over the tickets matching qualifier. No
+// request is made until Next is called.
+func (c *Client) TicketIterator(ctx context.Context, qualifier string, opts IteratorOptions) *TicketIterator {
+	return &TicketIterator{p: newPager(ctx, opts, func(ctx context.Context, limit uint, page uint) ([]Ticket, error) {
+		var tickets []Ticket
+		err := c.GetTickets(ctx, qualifier, limit, page, &tickets)
+		return tickets, err
+	})}
+}
+
+// Next advances to the next ticket, fetching a page when needed. It returns
+// false once the tickets are exhausted, MaxItems is reached or an error occurs.
+func (it *TicketIterator) Next() bool { return it.p.next() }
+
+// Ticket returns the ticket Next advanced to.
+func (it *TicketIterator) Ticket() Ticket { return it.p.cur }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *TicketIterator) Err() error { return it.p.err }
+
+// Close stops any page being prefetched. It is safe to call more than once.
+func (it *TicketIterator) Close() { it.p.close() }
+
+// Tickets returns an iter.Seq2 over the tickets matching qualifier. A failed
+// page request is yielded as the final error.
+func (c *Client) Tickets(ctx context.Context, qualifier string, opts IteratorOptions) iter.Seq2[Ticket, error] {
+	return func(yield func(Ticket, error) bool) {
+		c.TicketIterator(ctx, qualifier, opts).p.each(yield)
+	}
+}
+
+// AssetIterator walks every asset matching a qualifier, one page at a time.
+// It is used like TicketIterator.
+type AssetIterator struct {
+	p *pager[Asset]
+}
+
+// AssetIterator returns an iterator over the assets matching qualifier. No
+// request is made until Next is called.
+func (c *Client) AssetIterator(ctx context.Context, qualifier string, opts IteratorOptions) *AssetIterator {
+	return &AssetIterator{p: newPager(ctx, opts, func(ctx context.Context, limit uint, page uint) ([]Asset, error) {
+		var assets []Asset
+		err := c.GetAssets(ctx, qualifier, limit, page, &assets)
+		return assets, err
+	})}
+}
+
+// Next advances to the next asset, fetching a page when needed. It returns
+// false once the assets are exhausted, MaxItems is reached or an error occurs.
+func (it *AssetIterator) Next() bool { return it.p.next() }
+
+// Asset returns the asset Next advanced to.
+func (it *AssetIterator) Asset() Asset { return it.p.cur }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *AssetIterator) Err() error { return it.p.err }
+
+// Close stops any page being prefetched. It is safe to call more than once.
+func (it *AssetIterator) Close() { it.p.close() }
+
+// Assets returns an iter.Seq2 over the assets matching qualifier. A failed
+// page request is yielded as the final error.
+func (c *Client) Assets(ctx context.Context, qualifier string, opts IteratorOptions) iter.Seq2[Asset, error] {
+	return func(yield func(Asset, error) bool) {
+		c.AssetIterator(ctx, qualifier, opts).p.each(yield)
+	}
+}
+
+type pageFetcher[T any] func(ctx context.Context, limit uint, page uint) ([]T, error)
+
+type pageResult[T any] struct {
+	items []T
+	err   error
+}
+
+// pager holds the paging state shared by the typed iterators.
+type pager[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	fetch  pageFetcher[T]
+	opts   IteratorOptions
+
+	page    uint // last page requested
+	buf     []T
+	cur     T
+	seen    int
+	last    bool // the last page requested was short, there is nothing after it
+	pending chan pageResult[T]
+	err     error
+}
+
+func newPager[T any](ctx context.Context, opts IteratorOptions, fetch pageFetcher[T]) *pager[T] {
+	if opts.PageSize == 0 || opts.PageSize > 100 {
+		opts.PageSize = 100
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &pager[T]{
+		ctx:    ctx,
+		cancel: cancel,
+		fetch:  fetch,
+		opts:   opts,
+	}
+}
+
+func (p *pager[T]) next() bool {
+	if p.advance() {
+		return true
+	}
+
+	// nothing more to read, release the prefetch context right away
+	p.cancel()
+	return false
+}
+
+func (p *pager[T]) advance() bool {
+	if p.err != nil || (p.opts.MaxItems > 0 && p.seen >= p.opts.MaxItems) {
+		return false
+	}
+
+	for len(p.buf) == 0 {
+		if p.last && p.pending == nil {
+			return false
+		}
+
+		res := p.nextPage()
+		if res.err != nil {
+			p.err = res.err
+			return false
+		}
+		p.buf = res.items
+		p.prefetch()
+	}
+
+	p.cur, p.buf = p.buf[0], p.buf[1:]
+	p.seen++
+	return true
+}
+
+// nextPage returns the prefetched page if there is one, and fetches the next
+// page otherwise.
+func (p *pager[T]) nextPage() pageResult[T] {
+	if p.pending != nil {
+		res := <-p.pending
+		p.pending = nil
+		if uint(len(res.items)) < p.opts.PageSize {
+			p.last = true
+		}
+		return res
+	}
+
+	return p.request()
+}
+
+func (p *pager[T]) request() pageResult[T] {
+	p.page++
+	items, err := p.fetch(p.ctx, p.opts.PageSize, p.page)
+	if uint(len(items)) < p.opts.PageSize {
+		p.last = true
+	}
+	return pageResult[T]{items: items, err: err}
+}
+
+// prefetch starts fetching the page after the current one, unless prefetching
+// is off, there are no more pages or MaxItems is already covered.
+func (p *pager[T]) prefetch() {
+	if !p.opts.Prefetch || p.last || p.pending != nil {
+		return
+	}
+	if p.opts.MaxItems > 0 && p.seen+len(p.buf) >= p.opts.MaxItems {
+		return
+	}
+
+	pending := make(chan pageResult[T], 1)
+	p.pending = pending
+	p.page++
+	page := p.page
+	go func() {
+		items, err := p.fetch(p.ctx, p.opts.PageSize, page)
+		pending <- pageResult[T]{items: items, err: err}
+	}()
+}
+
+func (p *pager[T]) close() {
+	p.cancel()
+}
+
+// each drives an iter.Seq2 off the pager.
+func (p *pager[T]) each(yield func(T, error) bool) {
+	defer p.close()
+
+	for p.next() {
+		if !yield(p.cur, nil) {
+			return
+		}
+	}
+
+	if p.err != nil {
+		var zero T
+		yield(zero, p.err)
+	}
+}
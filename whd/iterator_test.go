@@ -0,0 +1,171 @@
+package whd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+// listRequests counts the requests srv received for the list of resource.
+func listRequests(srv *whdtest.Server, resource string) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if strings.HasSuffix(r.Path, "/"+resource) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTickets(t *testing.T) {
+	tests := []struct {
+		tickets      int
+		opts         whd.IteratorOptions
+		want         int
+		wantRequests int
+	}{
+		{23, whd.IteratorOptions{}, 23, 1},
+		{23, whd.IteratorOptions{PageSize: 5}, 23, 5},
+		{20, whd.IteratorOptions{PageSize: 5}, 20, 5},
+		{23, whd.IteratorOptions{PageSize: 5, Prefetch: true}, 23, 5},
+		{20, whd.IteratorOptions{PageSize: 5, Prefetch: true}, 20, 5},
+		{23, whd.IteratorOptions{PageSize: 5, MaxItems: 7}, 7, 2},
+		{23, whd.IteratorOptions{PageSize: 5, MaxItems: 7, Prefetch: true}, 7, 2},
+		{23, whd.IteratorOptions{PageSize: 5, MaxItems: 5, Prefetch: true}, 5, 1},
+		{23, whd.IteratorOptions{PageSize: 5, MaxItems: 100}, 23, 5},
+		{0, whd.IteratorOptions{Prefetch: true}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d tickets %+v", tt.tickets, tt.opts), func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+			for i := 0; i < tt.tickets; i++ {
+				srv.AddTicket(whd.Ticket{Subject: "s"})
+			}
+			c := srv.Client(whd.WithLogger(nil))
+
+			var ids []int
+			for ticket, err := range c.Tickets(context.Background(), "", tt.opts) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, ticket.Id)
+			}
+
+			if len(ids) != tt.want {
+				t.Errorf("got %d tickets, want %d", len(ids), tt.want)
+			}
+			for i, id := range ids {
+				if id != i+1 {
+					t.Fatalf("ticket %d has id %d, want the tickets in order", i, id)
+				}
+			}
+			if n := listRequests(srv, "Tickets"); n != tt.wantRequests {
+				t.Errorf("got %d page requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestTicketsPageError(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	for i := 0; i < 5; i++ {
+		srv.AddTicket(whd.Ticket{Subject: "s"})
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	it := c.TicketIterator(context.Background(), "", whd.IteratorOptions{PageSize: 2})
+	defer it.Close()
+
+	n := 0
+	for it.Next() {
+		n++
+		if n == 1 {
+			srv.Fail(whdtest.Failure{Path: "Tickets", Times: 1})
+		}
+	}
+
+	if n != 2 {
+		t.Errorf("got %d tickets before the failed page, want 2", n)
+	}
+	var apiErr *whd.APIError
+	if !errors.As(it.Err(), &apiErr) || apiErr.StatusCode != 500 {
+		t.Errorf("got error %v, want the failed page", it.Err())
+	}
+	if it.Next() {
+		t.Error("Next advanced after an error")
+	}
+}
+
+func TestTicketsYieldsError(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	srv.AddTicket(whd.Ticket{Subject: "s"})
+	srv.Fail(whdtest.Failure{Path: "Tickets", Status: 503})
+	c := srv.Client(whd.WithLogger(nil))
+
+	calls := 0
+	for _, err := range c.Tickets(context.Background(), "", whd.IteratorOptions{Prefetch: true}) {
+		calls++
+		if err == nil {
+			t.Fatal("got a ticket from a failing server")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("yielded %d times, want the error once", calls)
+	}
+}
+
+func TestTicketsBreak(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	for i := 0; i < 50; i++ {
+		srv.AddTicket(whd.Ticket{Subject: "s"})
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	for _, err := range c.Tickets(context.Background(), "", whd.IteratorOptions{PageSize: 5, Prefetch: true}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+
+	// the first page and at most the one being prefetched
+	if n := listRequests(srv, "Tickets"); n > 2 {
+		t.Errorf("got %d page requests after breaking out, want at most 2", n)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	for i := 0; i < 12; i++ {
+		srv.AddAsset(whd.Asset{AssetNumber: fmt.Sprintf("A-%d", i)})
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	it := c.AssetIterator(context.Background(), "", whd.IteratorOptions{PageSize: 5, Prefetch: true})
+	defer it.Close()
+
+	n := 0
+	for it.Next() {
+		if want := fmt.Sprintf("A-%d", n); it.Asset().AssetNumber != want {
+			t.Errorf("asset %d is %q, want %q", n, it.Asset().AssetNumber, want)
+		}
+		n++
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if n != 12 {
+		t.Errorf("got %d assets, want 12", n)
+	}
+}
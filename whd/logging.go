@@ -0,0 +1,157 @@
+package whd
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces credential values in logged URLs, cookies and errors.
+const redacted = "REDACTED"
+
+// sensitiveParams are the query parameters WrapAuth and the attachment upload
+// put credentials in.
+var sensitiveParams = []string{"apiKey", "password", "sessionKey", "wosid"}
+
+var packageLogger *slog.Logger
+
+// SetLogger sets the logger used by Clients created without WithLogger,
+// including the ones built by the package level functions. A nil logger (the
+// default) falls back to slog.Default().
+func SetLogger(logger *slog.Logger) {
+	packageLogger = logger
+}
+
+// WithLogger sets the logger the Client writes to. Request payloads are logged
+// at debug level, failures at warn or error level. Credentials are redacted
+// before logging. A nil logger turns logging off.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) {
+		if logger == nil {
+			logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		}
+		c.logger = logger
+	}
+}
+
+func defaultLogger() *slog.Logger {
+	if packageLogger != nil {
+		return packageLogger
+	}
+	return slog.Default()
+}
+
+// redactURL returns u as a string with every credential query parameter
+// replaced.
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	q := u.Query()
+	for _, p := range sensitiveParams {
+		if q.Has(p) {
+			q.Set(p, redacted)
+		}
+	}
+
+	r := *u
+	r.User = nil
+	r.RawQuery = q.Encode()
+	return r.String()
+}
+
+// cookieNames lists cookies by name only, as their values are session tokens.
+func cookieNames(cookies []*http.Cookie) []string {
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return names
+}
+
+// credentialParam matches a credential query parameter and its value inside
+// a URL that has already been turned into text.
+var credentialParam = regexp.MustCompile(`\b(` + strings.Join(sensitiveParams, "|") + `)=[^&\s"]*`)
+
+func redactString(s string) string {
+	return credentialParam.ReplaceAllString(s, "${1}="+redacted)
+}
+
+// redactError strips credentials from the message of err, which net/http and
+// retryablehttp build from the full request URL. The original error stays
+// reachable through errors.Is and errors.As.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	clean := redactString(msg)
+	if clean == msg {
+		return err
+	}
+
+	return &redactedError{msg: clean, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// retryLogger adapts a slog.Logger to retryablehttp's LeveledLogger, hiding
+// the credentials in the request URLs it logs. retryablehttp logs every
+// attempt, so its info and error messages are demoted to debug; a request that
+// finally fails is logged once at warn by logRequestFailed.
+type retryLogger struct {
+	logger *slog.Logger
+}
+
+func (l retryLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, redactArgs(keysAndValues)...)
+}
+
+func (l retryLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, redactArgs(keysAndValues)...)
+}
+
+func (l retryLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, redactArgs(keysAndValues)...)
+}
+
+func (l retryLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, redactArgs(keysAndValues)...)
+}
+
+func redactArgs(keysAndValues []interface{}) []interface{} {
+	args := make([]interface{}, len(keysAndValues))
+	for i, v := range keysAndValues {
+		switch v := v.(type) {
+		case *url.URL:
+			args[i] = redactURL(v)
+		case string:
+			args[i] = redactString(v)
+		case error:
+			args[i] = redactError(v)
+		default:
+			args[i] = v
+		}
+	}
+	return args
+}
+
+// logRequestFailed logs a request that did not get a response.
+func (c *Client) logRequestFailed(ctx context.Context, req *http.Request, err error) {
+	c.logger.WarnContext(ctx, "WHD request failed",
+		"method", req.Method,
+		"url", redactURL(req.URL),
+		"error", redactError(err))
+}
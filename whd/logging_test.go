@@ -0,0 +1,73 @@
+package whd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestFailedRequestLoggedOnce(t *testing.T) {
+	srv := whdtest.NewServer()
+	uri := srv.URL
+	srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := whd.NewClient(uri, srv.User(), whd.WithLogger(logger), whd.WithRetryPolicy(testRetryPolicy()))
+
+	var ticket whd.Ticket
+	if err := c.GetTicket(context.Background(), 1, &ticket); err == nil {
+		t.Fatal("got no error from a closed server")
+	}
+
+	out := buf.String()
+	if n := strings.Count(out, "level=WARN"); n != 1 {
+		t.Errorf("got %d warnings, want the failure logged once:\n%s", n, out)
+	}
+	if strings.Contains(out, "level=ERROR") {
+		t.Errorf("got errors logged, want the failure at warn only:\n%s", out)
+	}
+	if strings.Contains(out, srv.APIKey) {
+		t.Errorf("API key logged:\n%s", out)
+	}
+}
+
+// A failed list is returned to the caller, not logged as an error as well.
+func TestFailedListNotLogged(t *testing.T) {
+	ctx := context.Background()
+	lists := []struct {
+		name string
+		list func(c *whd.Client) error
+	}{
+		{"status types", func(c *whd.Client) error { return c.GetStatusTypeList(ctx, make(map[int]string)) }},
+		{"request types", func(c *whd.Client) error { return c.GetRequestTypeList(ctx, make(map[int]whd.RequestType)) }},
+		{"asset types", func(c *whd.Client) error { return c.GetAssetTypeList(ctx, make(map[int]whd.AssetType)) }},
+	}
+
+	for _, tt := range lists {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			c := srv.Client(whd.WithLogger(logger))
+			srv.Fail(whdtest.Failure{Status: http.StatusNotFound})
+
+			if err := tt.list(c); !errors.Is(err, whd.ErrNotFound) {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+			out := buf.String()
+			if strings.Contains(out, "level=ERROR") || strings.Count(out, "level=WARN") > 1 {
+				t.Errorf("got the failure logged:\n%s", out)
+			}
+		})
+	}
+}
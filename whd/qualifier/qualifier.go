@@ -0,0 +1,169 @@
+// Package qualifier builds the qualifier expressions Web Help Desk list
+// endpoints filter on, taking care of quoting and escaping values.
+//
+//	q := qualifier.And(
+//		qualifier.Eq("statustype.statusTypeName", "Open"),
+//		qualifier.Like("location.locationName", "ATL*"),
+//		qualifier.NotDeleted(),
+//	)
+//	client.GetTickets(ctx, q.String(), 100, 1, &tickets)
+//
+// The result is a plain string; URL encoding is left to the request, so
+// operators must not be pre-encoded (write "=", not "%3D").
+package qualifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout dates are formatted with. Dates are converted to
+// UTC first.
+const DateLayout = "2006-01-02T15:04:05Z"
+
+// Expr is a qualifier expression. The zero Expr is empty and is dropped by And
+// and Or.
+type Expr struct {
+	s string
+}
+
+// String returns the expression in WHD's qualifier syntax.
+func (e Expr) String() string {
+	return e.s
+}
+
+// IsEmpty reports whether e is the empty expression.
+func (e Expr) IsEmpty() bool {
+	return e.s == ""
+}
+
+// Raw wraps a hand-written qualifier so it can be combined with built ones.
+// It is parenthesised, so its own and/or operators stay grouped.
+func Raw(s string) Expr {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Expr{}
+	}
+	return Expr{s: "(" + s + ")"}
+}
+
+func compare(key string, op string, value interface{}) Expr {
+	return Expr{s: fmt.Sprintf("(%s %s %s)", key, op, Value(value))}
+}
+
+// Eq matches key equal to value.
+func Eq(key string, value interface{}) Expr { return compare(key, "=", value) }
+
+// Ne matches key not equal to value.
+func Ne(key string, value interface{}) Expr { return compare(key, "!=", value) }
+
+// Lt matches key less than value.
+func Lt(key string, value interface{}) Expr { return compare(key, "<", value) }
+
+// Le matches key less than or equal to value.
+func Le(key string, value interface{}) Expr { return compare(key, "<=", value) }
+
+// Gt matches key greater than value.
+func Gt(key string, value interface{}) Expr { return compare(key, ">", value) }
+
+// Ge matches key greater than or equal to value.
+func Ge(key string, value interface{}) Expr { return compare(key, ">=", value) }
+
+// Like matches key against pattern, where * matches any run of characters and
+// ? a single one. The match is case sensitive.
+func Like(key string, pattern string) Expr { return compare(key, "like", pattern) }
+
+// ILike is the case insensitive Like.
+func ILike(key string, pattern string) Expr { return compare(key, "caseInsensitiveLike", pattern) }
+
+// IsNull matches key not being set.
+func IsNull(key string) Expr { return compare(key, "=", nil) }
+
+// NotNull matches key being set.
+func NotNull(key string) Expr { return compare(key, "!=", nil) }
+
+// Before matches the date key strictly before t.
+func Before(key string, t time.Time) Expr { return Lt(key, t) }
+
+// After matches the date key strictly after t.
+func After(key string, t time.Time) Expr { return Gt(key, t) }
+
+// Between matches the date key within [from, to].
+func Between(key string, from time.Time, to time.Time) Expr {
+	return And(Ge(key, from), Le(key, to))
+}
+
+// NotDeleted matches records that have not been deleted.
+func NotDeleted() Expr {
+	return Or(IsNull("deleted"), Eq("deleted", 0))
+}
+
+// And matches when every expression matches. Empty expressions are ignored.
+func And(exprs ...Expr) Expr { return join("and", exprs) }
+
+// Or matches when any expression matches. Empty expressions are ignored.
+func Or(exprs ...Expr) Expr { return join("or", exprs) }
+
+// Not negates e.
+func Not(e Expr) Expr {
+	if e.IsEmpty() {
+		return e
+	}
+	return Expr{s: "(not " + e.s + ")"}
+}
+
+func join(op string, exprs []Expr) Expr {
+	parts := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		if !e.IsEmpty() {
+			parts = append(parts, e.s)
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return Expr{}
+	case 1:
+		return Expr{s: parts[0]}
+	}
+	return Expr{s: "(" + strings.Join(parts, " "+op+" ") + ")"}
+}
+
+// Value formats v as a qualifier literal: strings are single quoted with
+// quotes and backslashes escaped, booleans become 1 and 0, times are formatted
+// with DateLayout and nil is null. Anything else is formatted with %v and
+// quoted.
+func Value(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return quote(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int:
+		return strconv.Itoa(v)
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return quote(v.UTC().Format(DateLayout))
+	case fmt.Stringer:
+		return quote(v.String())
+	}
+	return quote(fmt.Sprintf("%v", v))
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
@@ -0,0 +1,39 @@
+package qualifier
+
+import (
+	"testing"
+	"time"
+)
+
+func TestString(t *testing.T) {
+	date := time.Date(2024, 3, 1, 14, 30, 0, 0, time.FixedZone("EST", -5*3600))
+
+	tests := []struct {
+		expr Expr
+		want string
+	}{
+		{Eq("subject", "it's"), `(subject = 'it\'s')`},
+		{Ne("id", 12), "(id != 12)"},
+		{Eq("deleted", true), "(deleted = 1)"},
+		{IsNull("detail"), "(detail = null)"},
+		{ILike("subject", "*fire*"), "(subject caseInsensitiveLike '*fire*')"},
+		{After("reportDateUtc", date), "(reportDateUtc > '2024-03-01T19:30:00Z')"},
+		{And(Eq("a", 1), Expr{}, Eq("b", 2)), "((a = 1) and (b = 2))"},
+		{Or(Eq("a", 1)), "(a = 1)"},
+		{And(), ""},
+		{Not(Eq("a", 1)), "(not (a = 1))"},
+		{Not(Expr{}), ""},
+		{NotDeleted(), "((deleted = null) or (deleted = 0))"},
+		{Raw("subject = 'x'"), "(subject = 'x')"},
+		{Raw("  "), ""},
+		// a raw or stays grouped when combined
+		{And(Raw("(a = 1) or (b = 2)"), Eq("deleted", true)), "(((a = 1) or (b = 2)) and (deleted = 1))"},
+		{And(Raw(""), Eq("deleted", true)), "(deleted = 1)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.expr.String(); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+}
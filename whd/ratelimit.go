@@ -0,0 +1,195 @@
+package whd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithRateLimit caps the Client at rate requests per second on average,
+// allowing bursts of up to burst requests. Every request counts, retries,
+// pages of list calls and attachment transfers included. Requests over the
+// limit wait for their turn, or until their context is done; the wait does not
+// count against WithTimeout.
+func WithRateLimit(rate float64, burst int) ClientOption {
+	return func(c *Client) {
+		if rate <= 0 {
+			c.limiter = nil
+			return
+		}
+		c.limiter = newTokenBucket(rate, max(burst, 1))
+	}
+}
+
+// WithMaxInFlight caps the number of requests the Client has open at once. A
+// request holds its slot until its response body is closed.
+func WithMaxInFlight(n int) ClientOption {
+	return func(c *Client) {
+		c.maxInFlight = n
+	}
+}
+
+// Stats describes the traffic a Client sent through its rate limiter and
+// concurrency cap.
+type Stats struct {
+	Requests     int64         // requests sent, retries included
+	InFlight     int64         // requests currently open
+	RateWaits    int64         // requests that waited for the rate limit
+	RateWait     time.Duration // total time spent waiting for the rate limit
+	InFlightWait time.Duration // total time spent waiting for a free slot
+}
+
+// Stats returns the Client's traffic counters so far.
+func (c *Client) Stats() Stats {
+	s := &c.limits.stats
+	return Stats{
+		Requests:     s.requests.Load(),
+		InFlight:     s.inFlight.Load(),
+		RateWaits:    s.rateWaits.Load(),
+		RateWait:     time.Duration(s.rateWait.Load()),
+		InFlightWait: time.Duration(s.inFlightWait.Load()),
+	}
+}
+
+type limitStats struct {
+	requests     atomic.Int64
+	inFlight     atomic.Int64
+	rateWaits    atomic.Int64
+	rateWait     atomic.Int64
+	inFlightWait atomic.Int64
+}
+
+// requestLimits applies the Client's rate limit and concurrency cap. They are
+// waited for before a request reaches the http.Client, so the wait does not
+// count against WithTimeout.
+type requestLimits struct {
+	limiter *tokenBucket  // nil for no rate limit
+	slots   chan struct{} // nil for no concurrency cap
+	stats   limitStats
+}
+
+func newRequestLimits(limiter *tokenBucket, maxInFlight int) *requestLimits {
+	l := &requestLimits{limiter: limiter}
+	if maxInFlight > 0 {
+		l.slots = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// acquire waits for the rate limit and then for a free slot. The returned
+// release frees the slot; it must be called once the request is done, retries
+// and response body included.
+func (l *requestLimits) acquire(ctx context.Context) (func(), error) {
+	if err := l.waitRate(ctx); err != nil {
+		return nil, err
+	}
+
+	if l.slots != nil {
+		start := time.Now()
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			l.stats.inFlightWait.Add(int64(time.Since(start)))
+			return nil, ctx.Err()
+		}
+		l.stats.inFlightWait.Add(int64(time.Since(start)))
+	}
+
+	l.stats.requests.Add(1)
+	l.stats.inFlight.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.stats.inFlight.Add(-1)
+			if l.slots != nil {
+				<-l.slots
+			}
+		})
+	}, nil
+}
+
+// prepareRetry waits for the rate limit before a retry, which keeps the slot
+// of the request it repeats. It is the retry client's PrepareRetry hook.
+func (l *requestLimits) prepareRetry(req *http.Request) error {
+	if err := l.waitRate(req.Context()); err != nil {
+		return err
+	}
+	l.stats.requests.Add(1)
+	return nil
+}
+
+func (l *requestLimits) waitRate(ctx context.Context) error {
+	if l.limiter == nil {
+		return nil
+	}
+
+	waited, err := l.limiter.wait(ctx)
+	if waited > 0 {
+		l.stats.rateWaits.Add(1)
+		l.stats.rateWait.Add(int64(waited))
+	}
+	return err
+}
+
+// releaseOnClose frees a request's slot once its response body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
+
+// tokenBucket is a token bucket rate limiter handing out reservations: a
+// request takes a token right away, possibly going into debt, and waits until
+// the debt is paid off.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes a token, waiting for it if needed. It returns how long it waited.
+// If ctx is done first, the token is given back.
+func (b *tokenBucket) wait(ctx context.Context) (time.Duration, error) {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	delay := time.Duration(0)
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return time.Since(now), ctx.Err()
+	}
+}
@@ -0,0 +1,144 @@
+package whd_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestRateLimit(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithRateLimit(100, 5), whd.WithMaxInFlight(2))
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var ticket whd.Ticket
+			if err := c.GetTicket(ctx, id, &ticket); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 5 requests go out in the burst, the other 20 at 100 per second
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("25 requests took %s, want at least 200ms", elapsed)
+	}
+	stats := c.Stats()
+	if stats.Requests != 25 || stats.InFlight != 0 || stats.RateWaits < 15 {
+		t.Errorf("got %+v, want 25 requests, none in flight and at least 15 waits", stats)
+	}
+}
+
+// The wait for the rate limit is not part of the request timeout.
+func TestRateLimitOutsideTimeout(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithTimeout(300*time.Millisecond), whd.WithRateLimit(1, 1))
+
+	var ticket whd.Ticket
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateNote(ctx, id, "after a wait of a second"); err != nil {
+		t.Fatalf("rate limited create: %v", err)
+	}
+	if n := len(srv.Notes(id)); n != 1 {
+		t.Errorf("got %d notes, want 1", n)
+	}
+}
+
+func TestRateLimitRetries(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithRetryPolicy(testRetryPolicy()), whd.WithRateLimit(5, 1))
+
+	srv.Fail(whdtest.Failure{Status: 503, Times: 1})
+	start := time.Now()
+	var ticket whd.Ticket
+	if err := c.GetTicket(context.Background(), id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.Stats()
+	if stats.Requests != 2 || stats.RateWaits != 1 || stats.InFlight != 0 {
+		t.Errorf("got %+v, want the retry counted and rate limited", stats)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("retry went out after %s, want it to wait for the rate limit", elapsed)
+	}
+}
+
+func TestRateLimitContext(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithRateLimit(0.5, 1))
+
+	var ticket whd.Ticket
+	if err := c.GetTicket(context.Background(), id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.GetTicket(ctx, id, &ticket); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context's error", err)
+	}
+	if n := c.Stats().Requests; n != 1 {
+		t.Errorf("sent %d requests, want the cancelled one held back", n)
+	}
+}
+
+func TestMaxInFlightHeldByBody(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	attId := srv.AddAttachment(id, "a.txt", []byte("hello"))
+	c := srv.Client(whd.WithLogger(nil), whd.WithMaxInFlight(1))
+
+	download, err := c.DownloadAttachment(ctx, attId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Stats().InFlight; n != 1 {
+		t.Errorf("%d requests in flight while the body is open, want 1", n)
+	}
+
+	// the slot is taken until the body is closed
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	var ticket whd.Ticket
+	if err := c.GetTicket(waitCtx, id, &ticket); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want to wait for the slot", err)
+	}
+
+	download.Body.Close()
+	if n := c.Stats().InFlight; n != 0 {
+		t.Errorf("%d requests in flight after Close, want 0", n)
+	}
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+}
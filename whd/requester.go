@@ -0,0 +1,181 @@
+package whd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	whdq "github.com/pvik/go-whd/whd/qualifier"
+)
+
+// Requester is a WHD Client: the end user a ticket is opened for. It is not
+// named Client to keep it apart from the API Client.
+type Requester struct {
+	Id           int           `json:"id,omitempty"`
+	Type         string        `json:"type,omitempty"`
+	FirstName    string        `json:"firstName,omitempty"`
+	LastName     string        `json:"lastName,omitempty"`
+	Email        string        `json:"email,omitempty"`
+	Username     string        `json:"username,omitempty"`
+	Phone        string        `json:"phone,omitempty"`
+	Room         string        `json:"room,omitempty"`
+	Location     Location      `json:"location,omitempty"`
+	Department   Department    `json:"department,omitempty"`
+	CustomFields []CustomField `json:"clientCustomFields,omitempty"`
+}
+
+type Department struct {
+	Id   int    `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func GetRequester(uri string, user User, id int, requester *Requester, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetRequester(context.Background(), id, requester)
+}
+
+func (c *Client) GetRequester(ctx context.Context, id int, requester *Requester) error {
+	req, err := c.newRequest(ctx, "GET", "Clients/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, &requester)
+}
+
+// GetRequesters queries WHD for the Clients matching qualifier, e.g.
+// qualifier.Eq("lastName", "Smith"). limit and page work as in GetTickets.
+func GetRequesters(uri string, user User, qualifier string, limit uint, page uint, requesters *[]Requester, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetRequesters(context.Background(), qualifier, limit, page, requesters)
+}
+
+func (c *Client) GetRequesters(ctx context.Context, qualifier string, limit uint, page uint, requesters *[]Requester) error {
+	req, err := c.newRequest(ctx, "GET", "Clients", nil)
+	if err != nil {
+		return err
+	}
+
+	if limit == 0 {
+		limit = 25
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	if page == 0 {
+		page = 1
+	}
+
+	q := req.URL.Query()
+	q.Add("qualifier", qualifier)
+	q.Add("limit", strconv.FormatUint(uint64(limit), 10))
+	q.Add("page", strconv.FormatUint(uint64(page), 10))
+	req.URL.RawQuery = q.Encode()
+
+	return c.doJSON(req, &requesters)
+}
+
+func FindRequesterByEmail(uri string, user User, email string, sslVerify bool) (Requester, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).FindRequesterByEmail(context.Background(), email)
+}
+
+// FindRequesterByEmail returns the Client with email, compared case
+// insensitively. It fails with ErrNotFound when there is none.
+func (c *Client) FindRequesterByEmail(ctx context.Context, email string) (Requester, error) {
+	return c.findRequester(ctx, "email", email, func(r Requester) string { return r.Email })
+}
+
+func FindRequesterByUsername(uri string, user User, username string, sslVerify bool) (Requester, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).FindRequesterByUsername(context.Background(), username)
+}
+
+// FindRequesterByUsername returns the Client with username, compared case
+// insensitively. It fails with ErrNotFound when there is none.
+func (c *Client) FindRequesterByUsername(ctx context.Context, username string) (Requester, error) {
+	return c.findRequester(ctx, "username", username, func(r Requester) string { return r.Username })
+}
+
+func (c *Client) findRequester(ctx context.Context, key string, value string, field func(Requester) string) (Requester, error) {
+	var requesters []Requester
+	if err := c.GetRequesters(ctx, whdq.ILike(key, value).String(), 100, 1, &requesters); err != nil {
+		return Requester{}, err
+	}
+
+	// like treats * and ? as wildcards, so only keep exact matches
+	for _, r := range requesters {
+		if strings.EqualFold(field(r), value) {
+			return r, nil
+		}
+	}
+
+	return Requester{}, fmt.Errorf("whd: no client with %s %q: %w", key, value, ErrNotFound)
+}
+
+func CreateUpdateRequester(uri string, user User, requester Requester, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).CreateUpdateRequester(context.Background(), requester)
+}
+
+// CreateUpdateRequester creates the Client when its Id is 0 and updates it
+// otherwise. Location and Department are sent by id only.
+func (c *Client) CreateUpdateRequester(ctx context.Context, requester Requester) (int, error) {
+	requesterMap := make(map[string]interface{})
+
+	if requester.Id != 0 {
+		var cache Requester
+		if err := c.GetRequester(ctx, requester.Id, &cache); err != nil {
+			return 0, err
+		}
+		requester.CustomFields = keepCustomFields(requester.CustomFields, cache.CustomFields)
+	}
+
+	// remove custom fields with empty value, unless they are being cleared
+	requester.CustomFields = dropEmptyCustomFields(requester.CustomFields)
+
+	if requester.Location.Id != 0 {
+		requester.Location = Location{
+			Id:   requester.Location.Id,
+			Type: "Location",
+		}
+	}
+
+	if requester.Department.Id != 0 {
+		requester.Department = Department{
+			Id:   requester.Department.Id,
+			Type: "Department",
+		}
+	}
+
+	interim, _ := json.Marshal(requester)
+	json.Unmarshal(interim, &requesterMap)
+
+	requesterMap["customFields"] = customFieldsPayload(requester.CustomFields)
+	delete(requesterMap, "clientCustomFields")
+
+	if requester.Location.Id == 0 {
+		delete(requesterMap, "location")
+	}
+	if requester.Department.Id == 0 {
+		delete(requesterMap, "department")
+	}
+
+	requesterJsonStr, _ := json.Marshal(requesterMap)
+	c.logger.DebugContext(ctx, "JSON sent to WHD", "json", string(requesterJsonStr))
+
+	method, resource := "POST", "Clients"
+	if requester.Id != 0 {
+		method, resource = "PUT", "Clients/"+strconv.Itoa(requester.Id)
+	}
+
+	req, err := c.newRequest(ctx, method, resource, requesterJsonStr)
+	if err != nil {
+		return 0, err
+	}
+
+	var result Requester
+	if err := c.doJSON(req, &result); err != nil {
+		return 0, err
+	}
+
+	return result.Id, nil
+}
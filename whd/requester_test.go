@@ -0,0 +1,111 @@
+package whd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestFindRequester(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	jdoe := srv.AddRequester(whd.Requester{Username: "jdoe", Email: "John.Doe@example.com"})
+	srv.AddRequester(whd.Requester{Username: "jdoe2", Email: "jdoe2@example.com"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	tests := []struct {
+		name  string
+		find  func(ctx context.Context, value string) (whd.Requester, error)
+		value string
+		want  int // 0 is ErrNotFound
+	}{
+		{"email", c.FindRequesterByEmail, "John.Doe@example.com", jdoe},
+		{"email in another case", c.FindRequesterByEmail, "john.doe@EXAMPLE.com", jdoe},
+		{"email wildcard", c.FindRequesterByEmail, "*@example.com", 0},
+		{"unknown email", c.FindRequesterByEmail, "nobody@example.com", 0},
+		{"username", c.FindRequesterByUsername, "JDOE", jdoe},
+		{"username prefix", c.FindRequesterByUsername, "jdoe?", 0},
+		{"unknown username", c.FindRequesterByUsername, "nobody", 0},
+	}
+
+	for _, tt := range tests {
+		r, err := tt.find(ctx, tt.value)
+		if tt.want == 0 {
+			if !errors.Is(err, whd.ErrNotFound) {
+				t.Errorf("%s: got %+v, %v, want ErrNotFound", tt.name, r, err)
+			}
+			continue
+		}
+		if err != nil || r.Id != tt.want {
+			t.Errorf("%s: got %+v, %v, want requester %d", tt.name, r, err, tt.want)
+		}
+	}
+}
+
+func TestCreateUpdateRequester(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	atl := srv.AddLocation(whd.Location{Name: "ATL"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	id, err := c.CreateUpdateRequester(ctx, whd.Requester{
+		FirstName: "John",
+		Username:  "jdoe",
+		Email:     "jdoe@example.com",
+		Location:  whd.Location{Id: atl, Name: "stale name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateUpdateRequester(ctx, whd.Requester{Id: id, Phone: "555-0100"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var r whd.Requester
+	if err := c.GetRequester(ctx, id, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.FirstName != "John" || r.Email != "jdoe@example.com" || r.Phone != "555-0100" {
+		t.Errorf("got %+v, want the update merged", r)
+	}
+	if r.Location.Id != atl || r.Location.Name != "ATL" {
+		t.Errorf("got location %+v, want ATL sent by id", r.Location)
+	}
+
+	if _, err := c.CreateUpdateRequester(ctx, whd.Requester{Id: 99}); !errors.Is(err, whd.ErrNotFound) {
+		t.Errorf("update of a missing requester: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestCreateUpdateTicketRequester(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	jdoe := srv.AddRequester(whd.Requester{Username: "jdoe", Email: "jdoe@example.com"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	id, err := c.CreateUpdateTicket(ctx, whd.Ticket{Subject: "s", RequesterId: jdoe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, _ := srv.Ticket(id)
+	if ticket.Requester.Id != jdoe || ticket.Requester.Username != "jdoe" {
+		t.Errorf("got requester %+v, want %d", ticket.Requester, jdoe)
+	}
+
+	// an update without a requester keeps it
+	if _, err := c.CreateUpdateTicket(ctx, whd.Ticket{Id: id, Detail: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if ticket, _ := srv.Ticket(id); ticket.Requester.Id != jdoe {
+		t.Errorf("got requester %+v after the update, want %d kept", ticket.Requester, jdoe)
+	}
+}
@@ -1,17 +1,12 @@
 package whd
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"strconv"
-	"time"
 
-	"github.com/hashicorp/go-retryablehttp"
+	"github.com/pvik/go-whd/whd/qualifier"
 )
 
 type RequestType struct {
@@ -25,189 +20,93 @@ func (rt RequestType) String() string {
 }
 
 func GetLocation(uri string, user User, id int, location *Location, sslVerify bool) error {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"Location/"+strconv.Itoa(id), nil)
-	if err != nil {
-		return err
-	}
-
-	WrapAuth(req, user)
-
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 30,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 30,
-		}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = 10
-	retryclient.HTTPClient = client
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetLocation(context.Background(), id, location)
+}
 
-	resp, err := retryclient.Do(req)
+func (c *Client) GetLocation(ctx context.Context, id int, location *Location) error {
+	req, err := c.newRequest(ctx, "GET", "Location/"+strconv.Itoa(id), nil)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
-
-	if err = json.Unmarshal(data, &location); err != nil {
-		log.Println("error unmarshalling: ", err)
 		return err
 	}
 
-	return nil
+	return c.doJSON(req, &location)
 }
 
 func CreateUpdateLocation(uri string, user User, whdLocation Location, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).CreateUpdateLocation(context.Background(), whdLocation)
+}
+
+func (c *Client) CreateUpdateLocation(ctx context.Context, whdLocation Location) (int, error) {
 	whdLocationMap := make(map[string]interface{})
 
 	if whdLocation.Id != 0 {
 		var whdLocCache Location
-		GetLocation(uri, user, whdLocation.Id, &whdLocCache, sslVerify)
-		// compare custom fields
-		for _, cf := range whdLocCache.CustomFields {
-			cfFound := false
-			for _, ncf := range whdLocation.CustomFields {
-				if cf.Id == ncf.Id {
-					cfFound = true
-					break
-				}
-			}
-			if !cfFound {
-				whdLocation.CustomFields = append(whdLocation.CustomFields, cf)
-			}
+		if err := c.GetLocation(ctx, whdLocation.Id, &whdLocCache); err != nil {
+			return 0, err
 		}
+		whdLocation.CustomFields = keepCustomFields(whdLocation.CustomFields, whdLocCache.CustomFields)
 	}
 
-	// remove custom fields with empty value
-	tempCfs := make([]CustomField, 0, 10)
-	for _, cf := range whdLocation.CustomFields {
-		if cf.Value != "" {
-			tempCfs = append(tempCfs, cf)
-		}
+	// remove custom fields with empty value, unless they are being cleared
+	whdLocation.CustomFields = dropEmptyCustomFields(whdLocation.CustomFields)
+
+	if err := c.validateCustomFieldsFor(ctx, LocationCustomFields, whdLocation.CustomFields, 0, whdLocation.Id == 0); err != nil {
+		return 0, err
 	}
-	whdLocation.CustomFields = tempCfs
 
 	interim, _ := json.Marshal(whdLocation)
 	json.Unmarshal(interim, &whdLocationMap)
 
 	delete(whdLocationMap, "lastUpdated")
-	whdLocationMap["customFields"] = whdLocationMap["locationCustomFields"]
+	whdLocationMap["customFields"] = customFieldsPayload(whdLocation.CustomFields)
 	delete(whdLocationMap, "locationCustomFields")
 
 	locationJsonStr, _ := json.Marshal(whdLocationMap)
-	log.Printf("JSON Sent to WHD: %s", locationJsonStr)
+	c.logger.DebugContext(ctx, "JSON sent to WHD", "json", string(locationJsonStr))
 	if whdLocation.Id == 0 {
-		return createLocation(uri, user, []byte(locationJsonStr), sslVerify)
+		return c.createLocation(ctx, []byte(locationJsonStr))
 	} else {
-		return updateLocation(uri, user, whdLocation.Id, []byte(locationJsonStr), sslVerify)
+		return c.updateLocation(ctx, whdLocation.Id, []byte(locationJsonStr))
 	}
 }
 
-func createLocation(uri string, user User, locationJsonStr []byte, sslVerify bool) (int, error) {
-	req, err := retryablehttp.NewRequest("POST", uri+urn+"Locations", bytes.NewBuffer(locationJsonStr))
+func (c *Client) createLocation(ctx context.Context, locationJsonStr []byte) (int, error) {
+	req, err := c.newRequest(ctx, "POST", "Locations", locationJsonStr)
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	WrapAuth(req, user)
-
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{Transport: tr}
-	} else {
-		client = &http.Client{}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = 10
-	retryclient.HTTPClient = client
-
-	resp, err := retryclient.Do(req)
-	//defer resp.Body.Close()
-	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Data:", string(data))
 	var location Location
-	if err = json.Unmarshal(data, &location); err != nil {
-		log.Printf("error unmarshalling: %s\n%s", string(data), err)
-		return 0, fmt.Errorf("Error: %v\n", string(data))
+	if err := c.doJSON(req, &location); err != nil {
+		return 0, err
 	}
 
 	return location.Id, nil
 }
 
-func updateLocation(uri string, user User, id int, locationJsonStr []byte, sslVerify bool) (int, error) {
-	req, err := retryablehttp.NewRequest("PUT", uri+urn+"Locations/"+strconv.Itoa(id), bytes.NewBuffer(locationJsonStr))
-	if err != nil {
-		return 0, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	WrapAuth(req, user)
-
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 90,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 90,
-		}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = 10
-	retryclient.HTTPClient = client
-
-	resp, err := retryclient.Do(req)
+func (c *Client) updateLocation(ctx context.Context, id int, locationJsonStr []byte) (int, error) {
+	req, err := c.newRequest(ctx, "PUT", "Locations/"+strconv.Itoa(id), locationJsonStr)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
 		return 0, err
 	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
 
 	var location Location
-	if err = json.Unmarshal(data, &location); err != nil {
-		log.Printf("error unmarshalling: %s\n%s", string(data), err)
-		return 0, fmt.Errorf("Error: %v\n", string(data))
+	if err := c.doJSON(req, &location); err != nil {
+		return 0, err
 	}
 
 	return location.Id, nil
 }
 
 func GetRequestTypeList(uri string, user User, result map[int]RequestType, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetRequestTypeList(context.Background(), result)
+}
+
+func (c *Client) GetRequestTypeList(ctx context.Context, result map[int]RequestType) error {
 	limit := 75
 
 	resMap := make(map[int][]byte)
-	if err := getResourceList(uri, user, "RequestTypes", limit, map[string]string{"list": "all"}, resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceList(ctx, "RequestTypes", limit, map[string]string{"list": "all"}, resMap); err != nil {
 		return err
 	}
 
@@ -215,12 +114,9 @@ func GetRequestTypeList(uri string, user User, result map[int]RequestType, sslVe
 		l := make([]RequestType, 0, limit)
 
 		if err := json.Unmarshal(data, &l); err != nil {
-			log.Println("error unmarshalling: ", err)
-			return err
+			return fmt.Errorf("whd: listing RequestTypes: invalid JSON: %w", err)
 		}
 
-		// log.Printf("pg: %d | str: %s\n", pg, string(data))
-		// log.Printf("unmarshalled: %+v\n", l)
 		for _, rt := range l {
 			result[rt.Id] = rt
 		}
@@ -230,11 +126,14 @@ func GetRequestTypeList(uri string, user User, result map[int]RequestType, sslVe
 }
 
 func GetStatusTypeList(uri string, user User, list map[int]string, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetStatusTypeList(context.Background(), list)
+}
+
+func (c *Client) GetStatusTypeList(ctx context.Context, list map[int]string) error {
 	limit := 50
 
 	resMap := make([]interface{}, 0, limit)
-	if err := getResourceListMap(uri, user, "StatusTypes", limit, nil, &resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceListMap(ctx, "StatusTypes", limit, nil, &resMap); err != nil {
 		return err
 	}
 
@@ -243,11 +142,14 @@ func GetStatusTypeList(uri string, user User, list map[int]string, sslVerify boo
 }
 
 func GetCustomFieldList(uri string, user User, list map[int]string, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetCustomFieldList(context.Background(), list)
+}
+
+func (c *Client) GetCustomFieldList(ctx context.Context, list map[int]string) error {
 	limit := 50
 
 	resMap := make([]interface{}, 0, limit)
-	if err := getResourceListMap(uri, user, "CustomFieldDefinitions", limit, nil, &resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceListMap(ctx, "CustomFieldDefinitions", limit, nil, &resMap); err != nil {
 		return err
 	}
 
@@ -256,11 +158,14 @@ func GetCustomFieldList(uri string, user User, list map[int]string, sslVerify bo
 }
 
 func GetLocationCustomFieldList(uri string, user User, list map[int]string, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetLocationCustomFieldList(context.Background(), list)
+}
+
+func (c *Client) GetLocationCustomFieldList(ctx context.Context, list map[int]string) error {
 	limit := 50
 
 	resMap := make([]interface{}, 0, limit)
-	if err := getResourceListMap(uri, user, "CustomFieldDefinitions/Location", limit, nil, &resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceListMap(ctx, "CustomFieldDefinitions/Location", limit, nil, &resMap); err != nil {
 		return err
 	}
 
@@ -269,11 +174,14 @@ func GetLocationCustomFieldList(uri string, user User, list map[int]string, sslV
 }
 
 func GetAssetCustomFieldList(uri string, user User, list map[int]string, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAssetCustomFieldList(context.Background(), list)
+}
+
+func (c *Client) GetAssetCustomFieldList(ctx context.Context, list map[int]string) error {
 	limit := 50
 
 	resMap := make([]interface{}, 0, limit)
-	if err := getResourceListMap(uri, user, "CustomFieldDefinitions/Asset", limit, nil, &resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceListMap(ctx, "CustomFieldDefinitions/Asset", limit, nil, &resMap); err != nil {
 		return err
 	}
 
@@ -282,11 +190,14 @@ func GetAssetCustomFieldList(uri string, user User, list map[int]string, sslVeri
 }
 
 func GetTechList(uri string, user User, list map[int]string, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTechList(context.Background(), list)
+}
+
+func (c *Client) GetTechList(ctx context.Context, list map[int]string) error {
 	limit := 50
 
 	resMap := make([]interface{}, 0, limit)
-	if err := getResourceListMap(uri, user, "Techs", limit, nil, &resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceListMap(ctx, "Techs", limit, nil, &resMap); err != nil {
 		return err
 	}
 
@@ -295,11 +206,14 @@ func GetTechList(uri string, user User, list map[int]string, sslVerify bool) err
 }
 
 func GetLocationList(uri string, user User, list map[int]string, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetLocationList(context.Background(), list)
+}
+
+func (c *Client) GetLocationList(ctx context.Context, list map[int]string) error {
 	limit := 250
 
 	resMap := make([]interface{}, 0, limit)
-	if err := getResourceListMap(uri, user, "Locations", limit, map[string]string{"qualifier": "((deleted=null)or(deleted=0))"}, &resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceListMap(ctx, "Locations", limit, map[string]string{"qualifier": qualifier.NotDeleted().String()}, &resMap); err != nil {
 		return err
 	}
 
@@ -308,11 +222,14 @@ func GetLocationList(uri string, user User, list map[int]string, sslVerify bool)
 }
 
 func GetPriorityTypeList(uri string, user User, list map[int]string, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetPriorityTypeList(context.Background(), list)
+}
+
+func (c *Client) GetPriorityTypeList(ctx context.Context, list map[int]string) error {
 	limit := 10
 
 	resMap := make([]interface{}, 0, limit)
-	if err := getResourceListMap(uri, user, "PriorityTypes", limit, nil, &resMap, sslVerify); err != nil {
-		log.Printf("error retrieving resource list: %s\n", err)
+	if err := c.getResourceListMap(ctx, "PriorityTypes", limit, nil, &resMap); err != nil {
 		return err
 	}
 
@@ -320,6 +237,70 @@ func GetPriorityTypeList(uri string, user User, list map[int]string, sslVerify b
 	return nil
 }
 
+func GetAssetTypeList(uri string, user User, result map[int]AssetType, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAssetTypeList(context.Background(), result)
+}
+
+func (c *Client) GetAssetTypeList(ctx context.Context, result map[int]AssetType) error {
+	l, err := getResourceListOf[AssetType](ctx, c, "AssetTypes", 50, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, at := range l {
+		result[at.Id] = at
+	}
+	return nil
+}
+
+func GetManufacturerList(uri string, user User, result map[int]Manufacturer, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetManufacturerList(context.Background(), result)
+}
+
+func (c *Client) GetManufacturerList(ctx context.Context, result map[int]Manufacturer) error {
+	l, err := getResourceListOf[Manufacturer](ctx, c, "Manufacturers", 50, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range l {
+		result[m.Id] = m
+	}
+	return nil
+}
+
+func GetModelList(uri string, user User, result map[int]Model, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetModelList(context.Background(), result)
+}
+
+func (c *Client) GetModelList(ctx context.Context, result map[int]Model) error {
+	l, err := getResourceListOf[Model](ctx, c, "Models", 100, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range l {
+		result[m.Id] = m
+	}
+	return nil
+}
+
+func GetAssetStatusList(uri string, user User, result map[int]AssetStatus, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAssetStatusList(context.Background(), result)
+}
+
+func (c *Client) GetAssetStatusList(ctx context.Context, result map[int]AssetStatus) error {
+	l, err := getResourceListOf[AssetStatus](ctx, c, "AssetStatuses", 50, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, as := range l {
+		result[as.Id] = as
+	}
+	return nil
+}
+
 func parseResourceListMap(idLabel string, valueLabel string, resMap *[]interface{}, list map[int]string) {
 	for _, data := range *resMap {
 		v := data.(map[string]interface{})
@@ -327,20 +308,21 @@ func parseResourceListMap(idLabel string, valueLabel string, resMap *[]interface
 	}
 }
 
-func getResourceList(uri string, user User, resource string, limit int, params map[string]string, result map[int][]byte, sslVerify bool) error {
+func (c *Client) getResourceList(ctx context.Context, resource string, limit int, params map[string]string, result map[int][]byte) error {
 	tmp := make([]interface{}, limit, limit)
 
 	for pg := 1; len(tmp) == limit; pg++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		data, err := getResourceListPage(uri, user, resource, limit, pg, params, sslVerify)
+		data, err := c.getResourceListPage(ctx, resource, limit, pg, params)
 		if err != nil {
-			log.Printf("error retrieving: %s\n", err)
-			return err
+			return fmt.Errorf("whd: listing %s, page %d: %w", resource, pg, err)
 		}
 
 		if err = json.Unmarshal(data, &tmp); err != nil {
-			log.Println("error unmarshalling: ", err)
-			return err
+			return fmt.Errorf("whd: listing %s, page %d: invalid JSON: %w", resource, pg, err)
 		}
 		result[pg] = data
 	}
@@ -348,20 +330,43 @@ func getResourceList(uri string, user User, resource string, limit int, params m
 	return nil
 }
 
-func getResourceListMap(uri string, user User, resource string, limit int, params map[string]string, result *[]interface{}, sslVerify bool) error {
+// getResourceListOf retrieves every page of resource and decodes the items
+// into T, in page order.
+func getResourceListOf[T any](ctx context.Context, c *Client, resource string, limit int, params map[string]string) ([]T, error) {
+	resMap := make(map[int][]byte)
+	if err := c.getResourceList(ctx, resource, limit, params, resMap); err != nil {
+		return nil, err
+	}
+
+	result := make([]T, 0, limit*len(resMap))
+	for pg := 1; pg <= len(resMap); pg++ {
+		l := make([]T, 0, limit)
+
+		if err := json.Unmarshal(resMap[pg], &l); err != nil {
+			return nil, fmt.Errorf("whd: listing %s, page %d: invalid JSON: %w", resource, pg, err)
+		}
+
+		result = append(result, l...)
+	}
+
+	return result, nil
+}
+
+func (c *Client) getResourceListMap(ctx context.Context, resource string, limit int, params map[string]string, result *[]interface{}) error {
 	tmp := make([]interface{}, limit, limit)
 
 	for pg := 1; len(tmp) == limit; pg++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		data, err := getResourceListPage(uri, user, resource, limit, pg, params, sslVerify)
+		data, err := c.getResourceListPage(ctx, resource, limit, pg, params)
 		if err != nil {
-			log.Printf("error retrieving: %s\n", err)
-			return err
+			return fmt.Errorf("whd: listing %s, page %d: %w", resource, pg, err)
 		}
 
 		if err = json.Unmarshal(data, &tmp); err != nil {
-			log.Printf("error unmarshalling: %s\nError: %s", string(data), err)
-			return err
+			return fmt.Errorf("whd: listing %s, page %d: invalid JSON: %w", resource, pg, err)
 		}
 		*result = append(*result, tmp...)
 	}
@@ -369,16 +374,14 @@ func getResourceListMap(uri string, user User, resource string, limit int, param
 	return nil
 }
 
-func getResourceListPage(uri string, user User, resource string, limit int, page int, params map[string]string, sslVerify bool) ([]byte, error) {
-	log.Printf("Get %s | limit: %d | page: %d", resource, limit, page)
+func (c *Client) getResourceListPage(ctx context.Context, resource string, limit int, page int, params map[string]string) ([]byte, error) {
+	c.logger.DebugContext(ctx, "get resource list page", "resource", resource, "limit", limit, "page", page)
 
-	req, err := retryablehttp.NewRequest("GET", uri+urn+resource, nil)
+	req, err := c.newRequest(ctx, "GET", resource, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	WrapAuth(req, user)
-
 	q := req.URL.Query()
 	q.Add("limit", strconv.Itoa(limit))
 	q.Add("page", strconv.Itoa(page))
@@ -388,34 +391,6 @@ func getResourceListPage(uri string, user User, resource string, limit int, page
 	}
 
 	req.URL.RawQuery = q.Encode()
-	//log.Printf("URL: %s\n", req.URL.String())
-
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 120,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 120,
-		}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = 10
-	retryclient.HTTPClient = client
-
-	resp, err := retryclient.Do(req)
-	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return nil, err
-	}
-
-	data, _ := ioutil.ReadAll(resp.Body)
-	return data, nil
 
+	return c.do(req)
 }
@@ -0,0 +1,165 @@
+package whd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// RetryPolicy decides which failed requests a Client sends again, and how long
+// it waits before doing so.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent at most, the first
+	// one included. 1 or less turns retries off.
+	MaxAttempts int
+	// MinWait and MaxWait bound the wait between two attempts.
+	MinWait time.Duration
+	MaxWait time.Duration
+	// Backoff returns the wait before retry number attempt (starting at 0),
+	// between min and max. It defaults to ExponentialBackoff.
+	Backoff func(attempt int, min time.Duration, max time.Duration) time.Duration
+	// Jitter randomly shortens each wait by up to this fraction (0 to 1), so
+	// that clients failing together do not retry together.
+	Jitter float64
+	// RetryStatus lists the HTTP statuses worth another attempt.
+	RetryStatus []int
+	// RetryNonIdempotent retries POST requests even when WHD may already have
+	// acted on them, at the risk of creating a ticket or note twice. Without
+	// it, a POST is only retried if it never reached WHD, was answered with
+	// 429 Too Many Requests, or its context is marked with Idempotent.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns the policy a Client uses unless told otherwise:
+// RETRY_MAX retries, exponential backoff from 1 to 30 seconds with 20%
+// jitter, on 429, 500, 502, 503 and 504, and no blind retry of creates.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: RETRY_MAX + 1,
+		MinWait:     time.Second,
+		MaxWait:     30 * time.Second,
+		Backoff:     ExponentialBackoff,
+		Jitter:      0.2,
+		RetryStatus: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// ExponentialBackoff doubles the wait with every attempt, starting at min and
+// capped at max.
+func ExponentialBackoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	wait := float64(min) * math.Pow(2, float64(attempt))
+	if wait > float64(max) {
+		return max
+	}
+	return time.Duration(wait)
+}
+
+// LinearBackoff waits min longer with every attempt, capped at max.
+func LinearBackoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	wait := min * time.Duration(attempt+1)
+	if wait > max || wait < 0 {
+		return max
+	}
+	return wait
+}
+
+// WithRetryPolicy sets how the Client retries failed requests.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks requests made with the returned context as safe to send
+// more than once, so that a POST made with it is retried like any other
+// request. Use it when a duplicate is harmless or is detected by other means.
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	v, _ := ctx.Value(idempotentKey{}).(bool)
+	return v
+}
+
+type requestMethodKey struct{}
+
+// withRequestMethod records method in ctx, as retryablehttp's CheckRetry only
+// sees the request context.
+func withRequestMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, requestMethodKey{}, method)
+}
+
+// checkRetry is the retryablehttp.CheckRetry of the Client's RetryPolicy.
+func (c *Client) checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	method, _ := ctx.Value(requestMethodKey{}).(string)
+	safe := method != http.MethodPost && method != http.MethodPatch ||
+		c.retryPolicy.RetryNonIdempotent || isIdempotent(ctx)
+
+	if err != nil {
+		// errors retryablehttp deems permanent, such as a bad certificate
+		if retry, _ := retryablehttp.DefaultRetryPolicy(ctx, nil, err); !retry {
+			return false, nil
+		}
+		return safe || notSent(err), nil
+	}
+
+	if !slices.Contains(c.retryPolicy.RetryStatus, resp.StatusCode) {
+		return false, nil
+	}
+	// WHD turned the request away without processing it
+	return safe || resp.StatusCode == http.StatusTooManyRequests, nil
+}
+
+// notSent reports whether err happened before the request reached the server,
+// making it safe to send again.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// backoff is the retryablehttp.Backoff of the Client's RetryPolicy. A
+// Retry-After header on 429 and 503 responses takes precedence, capped at
+// MaxWait.
+func (c *Client) backoff(minWait time.Duration, maxWait time.Duration, attempt int, resp *http.Response) time.Duration {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			return min(time.Duration(s)*time.Second, maxWait)
+		}
+	}
+
+	backoff := c.retryPolicy.Backoff
+	if backoff == nil {
+		backoff = ExponentialBackoff
+	}
+
+	wait := backoff(attempt, minWait, maxWait)
+	if j := c.retryPolicy.Jitter; j > 0 {
+		wait -= time.Duration(rand.Float64() * math.Min(j, 1) * float64(wait))
+	}
+	return wait
+}
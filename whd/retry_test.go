@@ -0,0 +1,185 @@
+package whd_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func testRetryPolicy() whd.RetryPolicy {
+	p := whd.DefaultRetryPolicy()
+	p.MaxAttempts = 3
+	p.MinWait = time.Millisecond
+	p.MaxWait = 5 * time.Millisecond
+	return p
+}
+
+func TestRetryClassification(t *testing.T) {
+	get := func(ctx context.Context, c *whd.Client, id int) error {
+		var ticket whd.Ticket
+		return c.GetTicket(ctx, id, &ticket)
+	}
+	create := func(ctx context.Context, c *whd.Client, id int) error {
+		_, err := c.CreateUpdateTicket(ctx, whd.Ticket{Subject: "new"})
+		return err
+	}
+	update := func(ctx context.Context, c *whd.Client, id int) error {
+		_, err := c.CreateUpdateTicket(ctx, whd.Ticket{Id: id, Detail: "d"})
+		return err
+	}
+
+	tests := []struct {
+		name           string
+		op             func(context.Context, *whd.Client, int) error
+		status         int
+		times          int
+		idempotent     bool
+		retryNonIdem   bool
+		wantAttempts   int
+		wantSuccessful bool
+	}{
+		{"GET on 503", get, 503, 2, false, false, 3, true},
+		{"GET gives up", get, 500, 0, false, false, 3, false},
+		{"GET on 404", get, 404, 1, false, false, 1, false},
+		{"PUT on 502", update, 502, 1, false, false, 2, true},
+		{"POST on 500", create, 500, 1, false, false, 1, false},
+		{"POST on 429", create, 429, 1, false, false, 2, true},
+		{"idempotent POST on 500", create, 500, 1, true, false, 2, true},
+		{"POST with RetryNonIdempotent", create, 503, 1, false, true, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			id := srv.AddTicket(whd.Ticket{Subject: "s"})
+			p := testRetryPolicy()
+			p.RetryNonIdempotent = tt.retryNonIdem
+			c := srv.Client(whd.WithLogger(nil), whd.WithRetryPolicy(p))
+
+			ctx := context.Background()
+			if tt.idempotent {
+				ctx = whd.Idempotent(ctx)
+			}
+
+			srv.Fail(whdtest.Failure{Status: tt.status, Times: tt.times})
+			before := len(srv.Requests())
+			err := tt.op(ctx, c, id)
+
+			if attempts := len(srv.Requests()) - before; attempts != tt.wantAttempts {
+				t.Errorf("sent %d times, want %d", attempts, tt.wantAttempts)
+			}
+			if (err == nil) != tt.wantSuccessful {
+				t.Errorf("got error %v, want success %v", err, tt.wantSuccessful)
+			}
+		})
+	}
+}
+
+func TestRetryUnsentPost(t *testing.T) {
+	srv := whdtest.NewServer()
+	uri := srv.URL
+	srv.Close()
+
+	// nothing listens any more, so the create never reached WHD
+	c := whd.NewClient(uri, srv.User(), whd.WithLogger(nil), whd.WithRetryPolicy(testRetryPolicy()))
+	if _, err := c.CreateUpdateTicket(context.Background(), whd.Ticket{Subject: "new"}); err == nil {
+		t.Fatal("create against a closed server succeeded")
+	}
+	if n := c.Stats().Requests; n != 3 {
+		t.Errorf("sent %d times, want 3", n)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	minWait, maxWait := 100*time.Millisecond, time.Second
+
+	tests := []struct {
+		name    string
+		backoff func(int, time.Duration, time.Duration) time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{"exponential", whd.ExponentialBackoff, 0, 100 * time.Millisecond},
+		{"exponential", whd.ExponentialBackoff, 1, 200 * time.Millisecond},
+		{"exponential", whd.ExponentialBackoff, 3, 800 * time.Millisecond},
+		{"exponential", whd.ExponentialBackoff, 4, time.Second},
+		{"exponential", whd.ExponentialBackoff, 100, time.Second},
+		{"linear", whd.LinearBackoff, 0, 100 * time.Millisecond},
+		{"linear", whd.LinearBackoff, 1, 200 * time.Millisecond},
+		{"linear", whd.LinearBackoff, 9, time.Second},
+		{"linear", whd.LinearBackoff, 50, time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := tt.backoff(tt.attempt, minWait, maxWait); got != tt.want {
+			t.Errorf("%s backoff of attempt %d = %s, want %s", tt.name, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// Cancelling the context ends the wait between attempts right away.
+func TestRetryCancelledDuringBackoff(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	p := testRetryPolicy()
+	p.MinWait = time.Minute
+	p.MaxWait = time.Minute
+	c := srv.Client(whd.WithLogger(nil), whd.WithRetryPolicy(p))
+	srv.Fail(whdtest.Failure{Status: http.StatusServiceUnavailable})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	var ticket whd.Ticket
+	err := c.GetTicket(ctx, id, &ticket)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want right after the cancel", elapsed)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("sent %d times, want once", n)
+	}
+}
+
+func TestListCancelled(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	for i := 0; i < 120; i++ {
+		srv.AddTicket(whd.Ticket{Subject: "s"})
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	// stop paging once the first page is in
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	var err error
+	for _, err = range c.Tickets(ctx, "", whd.IteratorOptions{}) {
+		if err != nil {
+			break
+		}
+		if n++; n == 1 {
+			cancel()
+		}
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if pages := listRequests(srv, "Tickets"); pages != 1 {
+		t.Errorf("read %d pages, want 1", pages)
+	}
+}
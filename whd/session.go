@@ -0,0 +1,127 @@
+package whd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// WithSession makes the Client log in once and authenticate every request with
+// the resulting session key instead of the API key or password. The session
+// is opened on the first request, opened again when WHD reports it expired,
+// and terminated by Close. It has no effect for SessionKeyAuth users and
+// SessionKeyAuthenticator, whose session is managed by the caller.
+func WithSession() ClientOption {
+	return func(c *Client) {
+		c.useSession = true
+	}
+}
+
+// session holds the key of the session a Client opened with WithSession.
+type session struct {
+	mu  sync.Mutex
+	key string
+}
+
+// sessionKey returns the current session key, logging in if there is none.
+func (c *Client) sessionKey(ctx context.Context) (string, error) {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+
+	if c.session.key == "" {
+		key, err := c.GetSessionKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		c.logger.DebugContext(ctx, "WHD session opened")
+		c.session.key = key
+	}
+
+	return c.session.key, nil
+}
+
+// renewSession logs in again after WHD rejected stale. Concurrent requests that
+// failed with the same key share a single new session.
+func (c *Client) renewSession(ctx context.Context, stale string) (string, error) {
+	c.session.mu.Lock()
+	if c.session.key == stale {
+		c.session.key = ""
+	}
+	c.session.mu.Unlock()
+
+	c.logger.InfoContext(ctx, "WHD session expired, logging in again")
+	return c.sessionKey(ctx)
+}
+
+// authorize adds the Client's credentials to req: the managed session key with
+// WithSession, the configured user or Authenticator otherwise.
+func (c *Client) authorize(ctx context.Context, req *retryablehttp.Request) error {
+	if c.session == nil {
+		return c.login(req)
+	}
+
+	key, err := c.sessionKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	auth := SessionKeyAuthenticator{Username: authUsername(c.auth), SessionKey: StaticSecret(key)}
+	if err := auth.Apply(req.Request); err != nil {
+		return err
+	}
+	return c.applyProxyAuth(req.Request)
+}
+
+// sessionExpired reports whether a response to a request authenticated with a
+// managed session says the session is no longer valid.
+func (c *Client) sessionExpired(req *retryablehttp.Request, statusCode int, data []byte) bool {
+	if c.session == nil || !req.URL.Query().Has("sessionKey") {
+		return false
+	}
+	if statusCode == http.StatusUnauthorized {
+		return true
+	}
+	return statusCode >= 400 && strings.Contains(strings.ToLower(parseReason(data)), "session")
+}
+
+// reauthorize swaps the expired session key of req for a new one.
+func (c *Client) reauthorize(req *retryablehttp.Request) error {
+	q := req.URL.Query()
+	key, err := c.renewSession(req.Context(), q.Get("sessionKey"))
+	if err != nil {
+		return err
+	}
+
+	q.Set("sessionKey", key)
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+// Close terminates the session opened by WithSession, if any. A Client used
+// after Close logs in again.
+func (c *Client) Close(ctx context.Context) error {
+	if c.session == nil {
+		return nil
+	}
+
+	c.session.mu.Lock()
+	key := c.session.key
+	c.session.key = ""
+	c.session.mu.Unlock()
+
+	if key == "" {
+		return nil
+	}
+
+	c.logger.DebugContext(ctx, "terminating WHD session")
+	err := c.TerminateSession(ctx, key)
+	if errors.Is(err, ErrUnauthorized) {
+		// the session already expired
+		return nil
+	}
+	return err
+}
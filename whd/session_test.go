@@ -0,0 +1,196 @@
+package whd_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+// logins counts the session logins srv received.
+func logins(srv *whdtest.Server) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if strings.HasSuffix(r.Path, "/Session") && r.Method == "GET" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSessionReused(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithSession())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var ticket whd.Ticket
+			if err := c.GetTicket(ctx, id, &ticket); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := logins(srv); n != 1 {
+		t.Errorf("logged in %d times, want once", n)
+	}
+	for _, r := range srv.Requests() {
+		if !strings.HasSuffix(r.Path, "/Session") && r.Query.Get("sessionKey") == "" {
+			t.Errorf("%s %s sent without the session key", r.Method, r.Path)
+		}
+	}
+
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Sessions(); n != 0 {
+		t.Errorf("%d sessions open after Close, want 0", n)
+	}
+}
+
+func TestSessionRenewed(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithSession())
+	defer c.Close(ctx)
+
+	var ticket whd.Ticket
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.ExpireSessions()
+
+	// a write after expiry is sent again with the new session
+	if _, err := c.CreateUpdateTicket(ctx, whd.Ticket{Id: id, Detail: "updated"}); err != nil {
+		t.Fatalf("update after the session expired: %v", err)
+	}
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Detail != "updated" {
+		t.Errorf("got detail %q, want the update applied", ticket.Detail)
+	}
+	if n := logins(srv); n != 2 {
+		t.Errorf("logged in %d times, want 2", n)
+	}
+	if n := srv.Sessions(); n != 1 {
+		t.Errorf("%d sessions open, want 1", n)
+	}
+}
+
+func TestUploadSessionTerminated(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []whd.ClientOption
+		want int
+	}{
+		{"api key", nil, 0},
+		// only the Client's own session stays open
+		{"with session", []whd.ClientOption{whd.WithSession()}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+			ctx := context.Background()
+
+			id := srv.AddTicket(whd.Ticket{Subject: "s"})
+			c := srv.Client(append([]whd.ClientOption{whd.WithLogger(nil)}, tt.opts...)...)
+			defer c.Close(ctx)
+
+			var ticket whd.Ticket
+			if err := c.GetTicket(ctx, id, &ticket); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.UploadAttachment(ctx, id, "a.txt", []byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			if n := srv.Sessions(); n != tt.want {
+				t.Errorf("%d sessions open after the upload, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloseExpiredSession(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithSession())
+
+	var ticket whd.Ticket
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	srv.ExpireSessions()
+
+	done := make(chan error, 1)
+	go func() { done <- c.Close(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	if n := logins(srv); n != 1 {
+		t.Errorf("logged in %d times, want once", n)
+	}
+}
+
+// A failed upload session terminate leaves the Client's own session alone.
+func TestUploadSessionTerminateFailed(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil), whd.WithSession())
+	defer c.Close(ctx)
+
+	var ticket whd.Ticket
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	srv.Fail(whdtest.Failure{Method: "DELETE", Path: "Session", Status: http.StatusUnauthorized, Times: 1})
+	if _, err := c.UploadAttachment(ctx, id, "a.txt", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted []string
+	for _, r := range srv.Requests() {
+		if r.Method == "DELETE" {
+			deleted = append(deleted, r.Query.Get("sessionKey"))
+		}
+	}
+	if len(deleted) != 1 || deleted[0] != "whdtest-session-2" {
+		t.Errorf("terminated sessions %v, want only the upload session", deleted)
+	}
+	if n := logins(srv); n != 2 {
+		t.Errorf("logged in %d times, want 2", n)
+	}
+}
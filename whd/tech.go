@@ -0,0 +1,96 @@
+package whd
+
+import (
+	"context"
+	"strconv"
+)
+
+// Tech is a WHD technician.
+type Tech struct {
+	Id              int              `json:"id,omitempty"`
+	Type            string           `json:"type,omitempty"`
+	FirstName       string           `json:"firstName,omitempty"`
+	LastName        string           `json:"lastName,omitempty"`
+	DisplayName     string           `json:"displayName,omitempty"`
+	Email           string           `json:"email,omitempty"`
+	LoginName       string           `json:"loginName,omitempty"`
+	Phone           string           `json:"phone,omitempty"`
+	IsAdmin         bool             `json:"isAdmin,omitempty"`
+	Inactive        bool             `json:"inactive,omitempty"`
+	TechGroups      []TechGroup      `json:"techGroups,omitempty"`
+	TechGroupLevels []TechGroupLevel `json:"techGroupLevels,omitempty"`
+	Permissions     map[string]bool  `json:"permissions,omitempty"` // WHD permission name -> granted
+}
+
+func (t Tech) String() string {
+	return t.DisplayName
+}
+
+// TechGroup is a WHD tech group with its escalation levels.
+type TechGroup struct {
+	Id     int              `json:"id,omitempty"`
+	Type   string           `json:"type,omitempty"`
+	Name   string           `json:"name,omitempty"`
+	Levels []TechGroupLevel `json:"techGroupLevels,omitempty"`
+	Techs  []Tech           `json:"techs,omitempty"`
+}
+
+func (tg TechGroup) String() string {
+	return tg.Name
+}
+
+func GetTech(uri string, user User, id int, tech *Tech, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTech(context.Background(), id, tech)
+}
+
+func (c *Client) GetTech(ctx context.Context, id int, tech *Tech) error {
+	req, err := c.newRequest(ctx, "GET", "Techs/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, &tech)
+}
+
+// GetTechs retrieves every tech. GetTechList is the lighter id -> display
+// name variant.
+func GetTechs(uri string, user User, techs *[]Tech, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTechs(context.Background(), techs)
+}
+
+func (c *Client) GetTechs(ctx context.Context, techs *[]Tech) error {
+	l, err := getResourceListOf[Tech](ctx, c, "Techs", 50, nil)
+	if err != nil {
+		return err
+	}
+
+	*techs = l
+	return nil
+}
+
+func GetTechGroup(uri string, user User, id int, techGroup *TechGroup, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTechGroup(context.Background(), id, techGroup)
+}
+
+func (c *Client) GetTechGroup(ctx context.Context, id int, techGroup *TechGroup) error {
+	req, err := c.newRequest(ctx, "GET", "TechGroups/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, &techGroup)
+}
+
+func GetTechGroups(uri string, user User, techGroups *[]TechGroup, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTechGroups(context.Background(), techGroups)
+}
+
+func (c *Client) GetTechGroups(ctx context.Context, techGroups *[]TechGroup) error {
+	l, err := getResourceListOf[TechGroup](ctx, c, "TechGroups", 50, nil)
+	if err != nil {
+		return err
+	}
+
+	*techGroups = l
+	return nil
+}
@@ -0,0 +1,113 @@
+package whd_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestGetTechs(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	// more than a page
+	for i := 1; i <= 60; i++ {
+		srv.AddTech(whd.Tech{DisplayName: fmt.Sprintf("Tech %d", i)})
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	var techs []whd.Tech
+	if err := c.GetTechs(ctx, &techs); err != nil {
+		t.Fatal(err)
+	}
+	if len(techs) != 60 || techs[0].DisplayName != "Tech 1" || techs[59].DisplayName != "Tech 60" {
+		t.Errorf("got %d techs, want all 60 in order", len(techs))
+	}
+
+	var tech whd.Tech
+	if err := c.GetTech(ctx, techs[41].Id, &tech); err != nil {
+		t.Fatal(err)
+	}
+	if tech.DisplayName != "Tech 42" {
+		t.Errorf("got %+v, want Tech 42", tech)
+	}
+	if err := c.GetTech(ctx, 99, &tech); !errors.Is(err, whd.ErrNotFound) {
+		t.Errorf("got %v for a missing tech, want ErrNotFound", err)
+	}
+}
+
+func TestGetTechGroups(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	levels := []whd.TechGroupLevel{{Id: 1, Level: 1, LevelName: "Tier 1"}, {Id: 2, Level: 2, LevelName: "Tier 2"}}
+	network := srv.AddTechGroup(whd.TechGroup{Name: "Network", Levels: levels})
+	srv.AddTechGroup(whd.TechGroup{Name: "Desktop"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	var groups []whd.TechGroup
+	if err := c.GetTechGroups(ctx, &groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Name != "Network" || groups[1].Name != "Desktop" {
+		t.Errorf("got %v, want Network and Desktop", groups)
+	}
+
+	var group whd.TechGroup
+	if err := c.GetTechGroup(ctx, network, &group); err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Levels) != 2 || group.Levels[1].LevelName != "Tier 2" {
+		t.Errorf("got levels %+v, want %+v", group.Levels, levels)
+	}
+}
+
+func TestTechGroupLevelJSON(t *testing.T) {
+	data := `{"id": 7, "type": "TechGroupLevel", "level": 2, "levelName": "Network Tier 2", "shortLevelName": "NT2"}`
+
+	var level whd.TechGroupLevel
+	if err := json.Unmarshal([]byte(data), &level); err != nil {
+		t.Fatal(err)
+	}
+	want := whd.TechGroupLevel{Id: 7, Type: "TechGroupLevel", Level: 2, LevelName: "Network Tier 2", ShortLevelName: "NT2"}
+	if level != want {
+		t.Errorf("got %+v, want %+v", level, want)
+	}
+}
+
+func TestCreateUpdateTicketAssignment(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	tech := srv.AddTech(whd.Tech{DisplayName: "Jane Tech", Email: "jane@example.com"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	id, err := c.CreateUpdateTicket(ctx, whd.Ticket{Subject: "s", TechId: tech, TechGroupLevelId: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]interface{}
+	srv.Get(whdtest.Tickets, id, &record)
+	for _, key := range []string{"techId", "techGroupLevelId"} {
+		if _, ok := record[key]; ok {
+			t.Errorf("sent %s, want only the references", key)
+		}
+	}
+
+	ticket, _ := srv.Ticket(id)
+	if ticket.ClientTech.Id != tech || ticket.ClientTech.DisplayName != "Jane Tech" {
+		t.Errorf("got tech %+v, want %d", ticket.ClientTech, tech)
+	}
+	if ticket.TechGroupLevel.Id != 7 || ticket.TechGroupLevel.Type != "TechGroupLevel" {
+		t.Errorf("got tech group level %+v, want 7", ticket.TechGroupLevel)
+	}
+}
@@ -2,22 +2,26 @@ package whd
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/hashicorp/go-retryablehttp"
+	whdq "github.com/pvik/go-whd/whd/qualifier"
 )
 
 type ProblemType struct {
@@ -46,6 +50,12 @@ type Asset struct {
 	NetworkAddress string        `json:"networkAddress,omitempty"`
 	NetworkName    string        `json:"networkName,omitempty"`
 	Location       Location      `json:"location,omitempty"`
+	Model          Model         `json:"model,omitempty"`
+	Manufacturer   Manufacturer  `json:"manufacturer,omitempty"`
+	AssetType      AssetType     `json:"assetType,omitempty"`
+	AssetStatus    AssetStatus   `json:"assetStatus,omitempty"`
+	PurchaseDate   *time.Time    `json:"purchaseDate,omitempty"`
+	WarrantyExpiry *time.Time    `json:"warrantyExpirationDate,omitempty"`
 	CustomFields   []CustomField `json:"assetCustomFields,omitempty"`
 }
 
@@ -61,9 +71,13 @@ type StatusType struct {
 	Name string `json:"statusTypeName,omitempty"`
 }
 
+// CustomField is the value of one custom field. CreateUpdate functions skip
+// fields with an empty Value, leaving them untouched in WHD; set Clear to blank
+// the field instead.
 type CustomField struct {
 	Id    int    `json:"definitionId,omitempty"`
 	Value string `json:"restValue,omitempty"`
+	Clear bool   `json:"-"`
 }
 
 type OrionAlert struct {
@@ -105,111 +119,92 @@ type TechGroupLevel struct {
 	Id             int    `json:"id,omitempty"`
 	Type           string `json:"type,omitempty"`
 	Level          int    `json:"level,omitempty"`
-	LevelName      string `json:"email,omitempty"`
-	ShortLevelName string `json:"displayName,omitempty"`
+	LevelName      string `json:"levelName,omitempty"`
+	ShortLevelName string `json:"shortLevelName,omitempty"`
 }
 
 type Ticket struct {
-	Id             int            `json:"id,omitempty"`
-	Detail         string         `json:"detail,omitempty"`
-	Subject        string         `json:"subject,omitempty"`
-	LastUpdated    time.Time      `json:"lastUpdated,omitempty"`
-	ReportDateUtc  string         `json:"reportDateUtc,omitempty"`
-	LocationId     int            `json:"locationId,omitempty"`
-	Location       Location       `json:"location,omitempty"`
-	StatusTypeId   int            `json:"statusTypeId,omitempty"`
-	StatusType     StatusType     `json:"statustype,omitempty"`
-	PriorityTypeId int            `json:"priorityTypeId,omitempty"`
-	PriorityType   PriorityType   `json:"prioritytype,omitempty"`
-	ProblemType    ProblemType    `json:"problemtype,omitempty"`
-	CustomFields   []CustomField  `json:"ticketCustomFields,omitempty"`
-	Assets         []Asset        `json:"assets,omitempty"`
-	Notes          []Note         `json:"notes,omitempty"`
-	Attachments    []Attachment   `json:"attachments,omitempty"`
-	ClientTech     ClientTech     `json:"clientTech,omitempty"`
-	TechGroupLevel TechGroupLevel `json:"techGroupLevel,omitempty"`
-	OrionAlert     OrionAlert     `json:"orionAlert,omitempty"`
-	EmailTech      bool           `json:"emailTech,omitempty"`
-	EmailClient    bool           `json:"emailClient"`
+	Id               int            `json:"id,omitempty"`
+	Detail           string         `json:"detail,omitempty"`
+	Subject          string         `json:"subject,omitempty"`
+	LastUpdated      time.Time      `json:"lastUpdated,omitempty"`
+	ReportDateUtc    string         `json:"reportDateUtc,omitempty"`
+	LocationId       int            `json:"locationId,omitempty"`
+	Location         Location       `json:"location,omitempty"`
+	StatusTypeId     int            `json:"statusTypeId,omitempty"`
+	StatusType       StatusType     `json:"statustype,omitempty"`
+	PriorityTypeId   int            `json:"priorityTypeId,omitempty"`
+	PriorityType     PriorityType   `json:"prioritytype,omitempty"`
+	ProblemType      ProblemType    `json:"problemtype,omitempty"`
+	CustomFields     []CustomField  `json:"ticketCustomFields,omitempty"`
+	Assets           []Asset        `json:"assets,omitempty"`
+	Notes            []Note         `json:"notes,omitempty"`
+	Attachments      []Attachment   `json:"attachments,omitempty"`
+	RequesterId      int            `json:"requesterId,omitempty"`
+	Requester        Requester      `json:"clientReporter,omitempty"`
+	TechId           int            `json:"techId,omitempty"`
+	ClientTech       ClientTech     `json:"clientTech,omitempty"`
+	TechGroupLevelId int            `json:"techGroupLevelId,omitempty"`
+	TechGroupLevel   TechGroupLevel `json:"techGroupLevel,omitempty"`
+	OrionAlert       OrionAlert     `json:"orionAlert,omitempty"`
+	EmailTech        bool           `json:"emailTech,omitempty"`
+	EmailClient      bool           `json:"emailClient"`
+	Deleted          bool           `json:"deleted,omitempty"`
 }
 
 func CreateNote(uri string, user User, whdTicketId int, noteTxt string, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).CreateNote(context.Background(), whdTicketId, noteTxt)
+}
+
+func CreateHiddenNote(uri string, user User, whdTicketId int, noteTxt string, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).CreateHiddenNote(context.Background(), whdTicketId, noteTxt)
+}
+
+func (c *Client) CreateNote(ctx context.Context, whdTicketId int, noteTxt string) (int, error) {
 	var note Note
 	note.JobTicket.Id = whdTicketId
 	note.JobTicket.Type = "JobTicket"
 	note.NoteText = noteTxt
 	note.IsHidden = false
-	return createNote(uri, user, whdTicketId, note, sslVerify)
+	return c.createNote(ctx, note)
 }
 
-func CreateHiddenNote(uri string, user User, whdTicketId int, noteTxt string, sslVerify bool) (int, error) {
+func (c *Client) CreateHiddenNote(ctx context.Context, whdTicketId int, noteTxt string) (int, error) {
 	var note Note
 	note.JobTicket.Id = whdTicketId
 	note.JobTicket.Type = "JobTicket"
 	note.NoteText = noteTxt
 	note.IsHidden = true
-	return createNote(uri, user, whdTicketId, note, sslVerify)
+	return c.createNote(ctx, note)
 }
 
-func createNote(uri string, user User, whdTicketId int, note Note, sslVerify bool) (int, error) {
+func (c *Client) createNote(ctx context.Context, note Note) (int, error) {
 	noteJsonStr, _ := json.Marshal(note)
-	log.Printf("JSON Sent to WHD: %s", noteJsonStr)
-	req, err := retryablehttp.NewRequest("POST", uri+urn+"TechNotes", bytes.NewBuffer(noteJsonStr))
+	c.logger.DebugContext(ctx, "JSON sent to WHD", "json", string(noteJsonStr))
+	req, err := c.newRequest(ctx, "POST", "TechNotes", noteJsonStr)
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	WrapAuth(req, user)
-
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 60,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 60,
-		}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
 
-	resp, err := retryclient.Do(req)
-	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
+	// a note WHD refuses comes back with a reason, which doJSON turns into
+	// an APIError
+	if err := c.doJSON(req, &note); err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
-	//log.Println("Data:", string(data))
-	if err = json.Unmarshal(data, &note); err != nil {
-		log.Printf("Error unmarshalling response for create note: %s\n%s", string(data), err)
-		return 0, fmt.Errorf("Error unmarshalling response for create note: %v\n", string(data))
-	}
 
-	if note.Reason == "" {
-		return note.Id, nil
-	} else {
-		return 0, fmt.Errorf("Unable to create note: %s", note.Reason)
-	}
+	return note.Id, nil
 }
 
 func GetNotes(uri string, user User, ticketID int, notes *[]Note, sslVerify bool) error {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"TicketNotes", nil)
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetNotes(context.Background(), ticketID, notes)
+}
+
+func (c *Client) GetNotes(ctx context.Context, ticketID int, notes *[]Note) error {
+	req, err := c.newRequest(ctx, "GET", "TicketNotes", nil)
 	if err != nil {
 		return err
 	}
 
-	WrapAuth(req, user)
-
 	q := req.URL.Query()
 
 	q.Add("jobTicketId", fmt.Sprintf("%d", ticketID))
@@ -217,105 +212,44 @@ func GetNotes(uri string, user User, ticketID int, notes *[]Note, sslVerify bool
 
 	req.URL.RawQuery = q.Encode()
 
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 90,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 90,
-		}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
-
-	resp, err := retryclient.Do(req)
-	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
-
-	if err = json.Unmarshal(data, &notes); err != nil {
-		log.Printf("Invalid JSON from WHD: %s\n", data)
-		return fmt.Errorf("Invalid JSON from WHD: %s", data)
-	}
-
-	return nil
+	return c.doJSON(req, &notes)
 }
 
 func GetTicket(uri string, user User, id int, ticket *Ticket, sslVerify bool) error {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"Ticket/"+strconv.Itoa(id), nil)
-	if err != nil {
-		return err
-	}
-
-	WrapAuth(req, user)
-
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 30,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 60,
-		}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTicket(context.Background(), id, ticket)
+}
 
-	resp, err := retryclient.Do(req)
+func (c *Client) GetTicket(ctx context.Context, id int, ticket *Ticket) error {
+	req, err := c.newRequest(ctx, "GET", "Ticket/"+strconv.Itoa(id), nil)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
 		return err
 	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
-
-	if err = json.Unmarshal(data, &ticket); err != nil {
-		log.Printf("Invalid JSON from WHD: %s\n", data)
-		return fmt.Errorf("Invalid JSON from WHD: %s", data)
-	}
 
-	return nil
+	return c.doJSON(req, &ticket)
 }
 
 // GetTickets allows you to query WHD for a list of tickets which matches
-// a qualifier
+// a qualifier, best built with the qualifier package
 // sample qualifier:
-//   - all tickets including deleted: ((deleted %3D null) or (deleted %3D 0) or (deleted %3D 1))
-//   - tickets in location ATL (location.locationName %3D 'ATL')
-//   - tickets in stauts New (statustype.statusTypeName %3D 'Open')
+//   - all tickets including deleted: ((deleted = null) or (deleted = 0) or (deleted = 1))
+//   - tickets in location ATL: qualifier.Eq("location.locationName", "ATL")
+//   - tickets in stauts Open: qualifier.Eq("statustype.statusTypeName", "Open")
 //
 // limit - limits the number of tickets returned, default is 25, max value is 100
 // page  - Page of results to retrieve. Returns `limit` number of items, starting
 //
 //	with item `(page*limit)` of the search results
 func GetTickets(uri string, user User, qualifier string, limit uint, page uint, ticket *[]Ticket, sslVerify bool) error {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"Tickets", nil)
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTickets(context.Background(), qualifier, limit, page, ticket)
+}
+
+// GetTickets is the Client counterpart of the package level GetTickets.
+func (c *Client) GetTickets(ctx context.Context, qualifier string, limit uint, page uint, ticket *[]Ticket) error {
+	req, err := c.newRequest(ctx, "GET", "Tickets", nil)
 	if err != nil {
 		return err
 	}
 
-	WrapAuth(req, user)
-
 	if limit == 0 {
 		limit = 25
 	} else if limit > 100 {
@@ -332,41 +266,14 @@ func GetTickets(uri string, user User, qualifier string, limit uint, page uint,
 	q.Add("page", strconv.FormatUint(uint64(page), 10))
 	req.URL.RawQuery = q.Encode()
 
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 90,
-		}
-	} else {
-		client = &http.Client{}
-	}
-
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
-
-	resp, err := retryclient.Do(req)
-	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
-
-	if err = json.Unmarshal(data, &ticket); err != nil {
-		log.Printf("Invalid JSON from WHD: %s\n", data)
-		return fmt.Errorf("Invalid JSON from WHD: %s", data)
-	}
-
-	return nil
+	return c.doJSON(req, &ticket)
 }
 
 func CreateUpdateTicket(uri string, user User, whdTicket Ticket, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).CreateUpdateTicket(context.Background(), whdTicket)
+}
+
+func (c *Client) CreateUpdateTicket(ctx context.Context, whdTicket Ticket) (int, error) {
 	whdTicketMap := make(map[string]interface{})
 
 	// reportDateUTC cannot be set when sending create/update transaction to WHD
@@ -393,20 +300,40 @@ func CreateUpdateTicket(uri string, user User, whdTicket Ticket, sslVerify bool)
 		}
 	}
 
-	// remove custom fields with empty value
-	tempCfs := make([]CustomField, 0, 10)
-	for _, cf := range whdTicket.CustomFields {
-		if cf.Value != "" {
-			tempCfs = append(tempCfs, cf)
+	if whdTicket.RequesterId != 0 {
+		whdTicket.Requester = Requester{
+			Id:   whdTicket.RequesterId,
+			Type: "Client",
+		}
+	}
+
+	// assign the ticket to a tech and/or a tech group level
+	if whdTicket.TechId != 0 {
+		whdTicket.ClientTech = ClientTech{
+			Id:   whdTicket.TechId,
+			Type: "Tech",
 		}
 	}
-	whdTicket.CustomFields = tempCfs
+
+	if whdTicket.TechGroupLevelId != 0 {
+		whdTicket.TechGroupLevel = TechGroupLevel{
+			Id:   whdTicket.TechGroupLevelId,
+			Type: "TechGroupLevel",
+		}
+	}
+
+	// remove custom fields with empty value, unless they are being cleared
+	whdTicket.CustomFields = dropEmptyCustomFields(whdTicket.CustomFields)
+
+	if err := c.validateCustomFieldsFor(ctx, TicketCustomFields, whdTicket.CustomFields, whdTicket.ProblemType.Id, whdTicket.Id == 0); err != nil {
+		return 0, err
+	}
 
 	interim, _ := json.Marshal(whdTicket)
 	json.Unmarshal(interim, &whdTicketMap)
 
 	delete(whdTicketMap, "lastUpdated")
-	whdTicketMap["customFields"] = whdTicketMap["ticketCustomFields"]
+	whdTicketMap["customFields"] = customFieldsPayload(whdTicket.CustomFields)
 	delete(whdTicketMap, "ticketCustomFields")
 
 	if whdTicket.ProblemType.Id == 0 {
@@ -421,404 +348,710 @@ func CreateUpdateTicket(uri string, user User, whdTicket Ticket, sslVerify bool)
 	if whdTicket.StatusTypeId == 0 {
 		delete(whdTicketMap, "statustype")
 	}
+	delete(whdTicketMap, "requesterId")
+	delete(whdTicketMap, "techId")
+	delete(whdTicketMap, "techGroupLevelId")
+	if whdTicket.ClientTech.Id == 0 {
+		delete(whdTicketMap, "clientTech")
+	} else {
+		whdTicketMap["clientTech"] = map[string]interface{}{
+			"id":   whdTicket.ClientTech.Id,
+			"type": "Tech",
+		}
+	}
+	if whdTicket.TechGroupLevel.Id == 0 {
+		delete(whdTicketMap, "techGroupLevel")
+	} else {
+		whdTicketMap["techGroupLevel"] = map[string]interface{}{
+			"id":   whdTicket.TechGroupLevel.Id,
+			"type": "TechGroupLevel",
+		}
+	}
+	if whdTicket.Requester.Id == 0 {
+		delete(whdTicketMap, "clientReporter")
+	} else {
+		whdTicketMap["clientReporter"] = map[string]interface{}{
+			"id":   whdTicket.Requester.Id,
+			"type": "Client",
+		}
+	}
+	// linked assets are sent by id only, so their details are left alone
+	if len(whdTicket.Assets) > 0 {
+		ids := make([]int, 0, len(whdTicket.Assets))
+		for _, a := range whdTicket.Assets {
+			ids = append(ids, a.Id)
+		}
+		whdTicketMap["assets"] = assetRefs(ids)
+	}
 
 	ticketJsonStr, _ := json.Marshal(whdTicketMap)
-	log.Printf("JSON Sent to WHD: %s", ticketJsonStr)
+	c.logger.DebugContext(ctx, "JSON sent to WHD", "json", string(ticketJsonStr))
 	if whdTicket.Id == 0 {
-		return createTicket(uri, user, []byte(ticketJsonStr), sslVerify)
+		return c.createTicket(ctx, []byte(ticketJsonStr))
 	} else {
-		return updateTicket(uri, user, whdTicket.Id, []byte(ticketJsonStr), sslVerify)
+		return c.updateTicket(ctx, whdTicket.Id, []byte(ticketJsonStr))
 	}
 }
 
-func createTicket(uri string, user User, ticketJsonStr []byte, sslVerify bool) (int, error) {
-	req, err := retryablehttp.NewRequest("POST", uri+urn+"Ticket", bytes.NewBuffer(ticketJsonStr))
-	if err != nil {
-		return 0, err
+func UpdateTicketIfUnchanged(uri string, user User, whdTicket Ticket, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).UpdateTicketIfUnchanged(context.Background(), whdTicket)
+}
+
+// UpdateTicketIfUnchanged updates whdTicket like CreateUpdateTicket, but only
+// if the ticket in WHD still has whdTicket's LastUpdated. Otherwise nothing is
+// sent and a *ConflictError holding the current ticket is returned. WHD has no
+// conditional update, so a write landing between the check and the update
+// still goes unnoticed; the window is one request long.
+func (c *Client) UpdateTicketIfUnchanged(ctx context.Context, whdTicket Ticket) (int, error) {
+	if whdTicket.Id == 0 || whdTicket.LastUpdated.IsZero() {
+		return 0, fmt.Errorf("whd: UpdateTicketIfUnchanged needs a ticket read from WHD, with Id and LastUpdated: %w", ErrValidation)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	WrapAuth(req, user)
+	var current Ticket
+	if err := c.GetTicket(ctx, whdTicket.Id, &current); err != nil {
+		return 0, err
+	}
 
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{Transport: tr}
-	} else {
-		client = &http.Client{}
+	if !current.LastUpdated.Equal(whdTicket.LastUpdated) {
+		return 0, &ConflictError{Id: whdTicket.Id, Expected: whdTicket.LastUpdated, Current: current}
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	return c.CreateUpdateTicket(ctx, whdTicket)
+}
 
-	resp, err := retryclient.Do(req)
-	//defer resp.Body.Close()
-	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
+func UpdateTicketWithMerge(uri string, user User, id int, maxAttempts int, merge func(*Ticket) error, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).UpdateTicketWithMerge(context.Background(), id, maxAttempts, merge)
+}
+
+// UpdateTicketWithMerge reads ticket id, lets merge apply the caller's changes
+// to it and writes it back with UpdateTicketIfUnchanged. On a conflict merge
+// is called again on the fresh ticket, up to maxAttempts times in total (3
+// when zero). An error from merge aborts the update and is returned as is.
+func (c *Client) UpdateTicketWithMerge(ctx context.Context, id int, maxAttempts int, merge func(*Ticket) error) (int, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	var ticket Ticket
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
 		return 0, err
 	}
 
-	defer resp.Body.Close()
-	data, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Data:", string(data))
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = merge(&ticket); err != nil {
+			return 0, err
+		}
 
-	var ticket Ticket
-	if err = json.Unmarshal(data, &ticket); err != nil {
-		log.Printf("error unmarshalling: %s\n%s", string(data), err)
-		return 0, fmt.Errorf("Error: %v\n", string(data))
+		var tid int
+		tid, err = c.UpdateTicketIfUnchanged(ctx, ticket)
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			return tid, err
+		}
+
+		c.logger.DebugContext(ctx, "ticket changed concurrently, merging again",
+			"id", id, "attempt", attempt)
+		ticket = conflict.Current
 	}
 
-	return ticket.Id, nil
+	return 0, err
 }
 
-func updateTicket(uri string, user User, id int, ticketJsonStr []byte, sslVerify bool) (int, error) {
-	req, err := retryablehttp.NewRequest("PUT", uri+urn+"Ticket/"+strconv.Itoa(id), bytes.NewBuffer(ticketJsonStr))
+func (c *Client) createTicket(ctx context.Context, ticketJsonStr []byte) (int, error) {
+	req, err := c.newRequest(ctx, "POST", "Ticket", ticketJsonStr)
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	WrapAuth(req, user)
-
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 90,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 90,
-		}
+	var ticket Ticket
+	if err := c.doJSON(req, &ticket); err != nil {
+		return 0, err
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	return ticket.Id, nil
+}
 
-	resp, err := retryclient.Do(req)
+func (c *Client) updateTicket(ctx context.Context, id int, ticketJsonStr []byte) (int, error) {
+	req, err := c.newRequest(ctx, "PUT", "Ticket/"+strconv.Itoa(id), ticketJsonStr)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
 		return 0, err
 	}
-	defer resp.Body.Close()
-
-	data, _ := ioutil.ReadAll(resp.Body)
 
 	var ticket Ticket
-	if err = json.Unmarshal(data, &ticket); err != nil {
-		log.Printf("error unmarshalling: %s\n%s", string(data), err)
-		return 0, fmt.Errorf("Error: %v\n", string(data))
+	if err := c.doJSON(req, &ticket); err != nil {
+		return 0, err
 	}
 
 	return ticket.Id, nil
 }
 
-func GetAttachment(uri string, user User, attachmentId int, sslVerify bool) ([]byte, error) {
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"TicketAttachments/"+strconv.Itoa(attachmentId), nil)
+func DeleteTicket(uri string, user User, id int, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).DeleteTicket(context.Background(), id)
+}
+
+func RestoreTicket(uri string, user User, id int, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).RestoreTicket(context.Background(), id)
+}
+
+func DeleteTickets(uri string, user User, qualifier string, sslVerify bool) ([]int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).DeleteTickets(context.Background(), qualifier)
+}
+
+func RestoreTickets(uri string, user User, qualifier string, sslVerify bool) ([]int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).RestoreTickets(context.Background(), qualifier)
+}
+
+// DeleteTicket deletes ticket id. WHD only flags the ticket as deleted, so it
+// can be brought back with RestoreTicket.
+func (c *Client) DeleteTicket(ctx context.Context, id int) error {
+	req, err := c.newRequest(ctx, "DELETE", "Ticket/"+strconv.Itoa(id), nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	WrapAuth(req, user)
-	req.Header.Set("accept", "application/octet")
+	_, err = c.do(req)
+	return err
+}
 
-	var client *http.Client
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 120,
+// RestoreTicket undeletes ticket id.
+func (c *Client) RestoreTicket(ctx context.Context, id int) error {
+	ticketJsonStr, _ := json.Marshal(map[string]interface{}{"deleted": false})
+	_, err := c.updateTicket(ctx, id, ticketJsonStr)
+	return err
+}
+
+// DeleteTickets deletes every ticket matching qualifier and returns the ids
+// deleted. The matches are collected before anything is deleted, so the
+// deletions do not shift the pages being read. On error the ids deleted so far
+// are returned with it. A blank qualifier would match every ticket, so it is
+// rejected with ErrValidation.
+func (c *Client) DeleteTickets(ctx context.Context, qualifier string) ([]int, error) {
+	if strings.TrimSpace(qualifier) == "" {
+		return nil, fmt.Errorf("whd: DeleteTickets needs a qualifier: %w", ErrValidation)
+	}
+	return c.forEachTicketId(ctx, qualifier, c.DeleteTicket)
+}
+
+// RestoreTickets undeletes every deleted ticket matching qualifier and
+// returns the ids restored. Only deleted tickets are considered, whether or
+// not qualifier mentions the deleted flag; a blank qualifier restores every
+// deleted ticket.
+func (c *Client) RestoreTickets(ctx context.Context, qualifier string) ([]int, error) {
+	q := whdq.And(whdq.Raw(qualifier), whdq.Eq("deleted", true))
+	return c.forEachTicketId(ctx, q.String(), c.RestoreTicket)
+}
+
+func (c *Client) forEachTicketId(ctx context.Context, qualifier string, fn func(context.Context, int) error) ([]int, error) {
+	ids := make([]int, 0)
+	for ticket, err := range c.Tickets(ctx, qualifier, IteratorOptions{}) {
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		client = &http.Client{
-			Timeout: time.Second * 120,
+		ids = append(ids, ticket.Id)
+	}
+
+	done := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if err := fn(ctx, id); err != nil {
+			return done, err
 		}
+		done = append(done, id)
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	return done, nil
+}
 
-	resp, err := retryclient.Do(req)
-	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return nil, err
+func AttachAssetsToTicket(uri string, user User, ticketId int, assetIds []int, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).AttachAssetsToTicket(context.Background(), ticketId, assetIds...)
+}
+
+func DetachAssetFromTicket(uri string, user User, ticketId int, assetId int, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).DetachAssetFromTicket(context.Background(), ticketId, assetId)
+}
+
+// AttachAssetsToTicket links assetIds to ticket ticketId, keeping the assets
+// already linked. Assets already on the ticket are not added twice.
+func (c *Client) AttachAssetsToTicket(ctx context.Context, ticketId int, assetIds ...int) error {
+	return c.updateTicketAssets(ctx, ticketId, func(ids []int) []int {
+		for _, id := range assetIds {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	})
+}
+
+// DetachAssetFromTicket unlinks asset assetId from ticket ticketId, keeping
+// the other assets linked. Detaching an asset that is not linked is not an
+// error.
+func (c *Client) DetachAssetFromTicket(ctx context.Context, ticketId int, assetId int) error {
+	return c.updateTicketAssets(ctx, ticketId, func(ids []int) []int {
+		return slices.DeleteFunc(ids, func(id int) bool { return id == assetId })
+	})
+}
+
+// updateTicketAssets reads the assets linked to ticket ticketId, lets merge
+// change their ids and writes the list back. WHD replaces the whole list on
+// update, so it is always sent in full.
+func (c *Client) updateTicketAssets(ctx context.Context, ticketId int, merge func([]int) []int) error {
+	var ticket Ticket
+	if err := c.GetTicket(ctx, ticketId, &ticket); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
 
-	data, _ := ioutil.ReadAll(resp.Body)
+	ids := make([]int, 0, len(ticket.Assets))
+	for _, a := range ticket.Assets {
+		ids = append(ids, a.Id)
+	}
+	ids = merge(ids)
 
-	return data, nil
+	ticketJsonStr, _ := json.Marshal(map[string]interface{}{"assets": assetRefs(ids)})
+	c.logger.DebugContext(ctx, "JSON sent to WHD", "json", string(ticketJsonStr))
+	_, err := c.updateTicket(ctx, ticketId, ticketJsonStr)
+	return err
 }
 
-func GetAttachmentAsBase64(uri string, user User, attachmentId int, sslVerify bool) (string, error) {
-	data, err := GetAttachment(uri, user, attachmentId, sslVerify)
-	if err != nil {
-		return "", err
+// assetRefs returns ids as the asset references of a ticket payload.
+func assetRefs(ids []int) []map[string]interface{} {
+	assets := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		assets = append(assets, map[string]interface{}{"id": id, "type": "Asset"})
 	}
+	return assets
+}
 
-	return base64.StdEncoding.EncodeToString(data), nil
+func GetTicketsForAsset(uri string, user User, assetId int, limit uint, page uint, ticket *[]Ticket, sslVerify bool) error {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetTicketsForAsset(context.Background(), assetId, limit, page, ticket)
 }
 
-func UploadAttachment(uri string, user User, ticketId int, filename string, filedata []byte, sslVerify bool) (int, error) {
-	return UploadAttachmentToEntity(uri, user, "jobTicket", ticketId, filename, filedata, sslVerify)
+// GetTicketsForAsset returns a page of the tickets asset assetId is linked
+// to. Use Tickets with AssetQualifier to walk every page.
+func (c *Client) GetTicketsForAsset(ctx context.Context, assetId int, limit uint, page uint, ticket *[]Ticket) error {
+	return c.GetTickets(ctx, AssetQualifier(assetId), limit, page, ticket)
 }
 
-func UploadAttachmentToNote(uri string, user User, noteId int, filename string, filedata []byte, sslVerify bool) (int, error) {
-	return UploadAttachmentToEntity(uri, user, "techNote", noteId, filename, filedata, sslVerify)
+// AssetQualifier returns the qualifier matching the tickets asset assetId is
+// linked to. It can be combined with other conditions using the qualifier
+// package.
+func AssetQualifier(assetId int) string {
+	return whdq.Eq("assets.id", assetId).String()
 }
 
-func UploadAttachmentToNoteFromFile(uri string, user User, noteId int, filename string, fullFilePath string, deleteFileAfter bool, sslVerify bool) (int, error) {
-	// read in file
-	filedata, err := ioutil.ReadFile(fullFilePath)
+func GetAttachment(uri string, user User, attachmentId int, sslVerify bool) ([]byte, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAttachment(context.Background(), attachmentId)
+}
 
+func (c *Client) GetAttachment(ctx context.Context, attachmentId int) ([]byte, error) {
+	req, err := c.newRequest(ctx, "GET", "TicketAttachments/"+strconv.Itoa(attachmentId), nil)
 	if err != nil {
-		return 0, fmt.Errorf("unable to read PDF file: %+v", err)
+		return nil, err
 	}
 
-	attId, err := UploadAttachmentToNote(uri, user, noteId, filename, filedata, sslVerify)
+	req.Header.Set("accept", "application/octet")
+
+	return c.do(req)
+}
+
+func GetAttachmentAsBase64(uri string, user User, attachmentId int, sslVerify bool) (string, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).GetAttachmentAsBase64(context.Background(), attachmentId)
+}
 
+func (c *Client) GetAttachmentAsBase64(ctx context.Context, attachmentId int) (string, error) {
+	data, err := c.GetAttachment(ctx, attachmentId)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
-	if deleteFileAfter {
-		os.Remove(fullFilePath)
-	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
 
-	return attId, nil
+// AttachmentInfo describes a downloaded attachment, as reported by the
+// response headers.
+type AttachmentInfo struct {
+	ContentType   string
+	ContentLength int64  // -1 when WHD did not send a length
+	FileName      string // from Content-Disposition, "" when not sent
 }
 
-func UploadAttachmentToTicketFromFile(uri string, user User, ticketId int, filename string, fullFilePath string, deleteFileAfter bool, sslVerify bool) (int, error) {
-	// read in file
-	filedata, err := ioutil.ReadFile(fullFilePath)
+// AttachmentDownload is an attachment being streamed from WHD. Body must be
+// closed by the caller.
+type AttachmentDownload struct {
+	AttachmentInfo
+	Body io.ReadCloser
+}
 
+// DownloadAttachment opens attachment attachmentId for reading without
+// buffering it. The Client timeout covers reading Body, so large files may
+// need a Client with a longer timeout.
+func (c *Client) DownloadAttachment(ctx context.Context, attachmentId int) (*AttachmentDownload, error) {
+	req, err := c.newRequest(ctx, "GET", "TicketAttachments/"+strconv.Itoa(attachmentId), nil)
 	if err != nil {
-		return 0, fmt.Errorf("unable to read PDF file: %+v", err)
+		return nil, err
 	}
 
-	attId, err := UploadAttachment(uri, user, ticketId, filename, filedata, sslVerify)
+	req.Header.Set("accept", "application/octet")
 
+	resp, err := c.stream(req)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if deleteFileAfter {
-		os.Remove(fullFilePath)
+	info := AttachmentInfo{
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		info.FileName = params["filename"]
 	}
 
-	return attId, nil
+	return &AttachmentDownload{AttachmentInfo: info, Body: resp.Body}, nil
 }
 
-func UploadAttachmentToEntity(uri string, user User, entity string, entityId int, filename string, filedata []byte, sslVerify bool) (int, error) {
-	cookieJar, _ := cookiejar.New(nil)
-
-	// get session key to get JSESSIONID and wosid
-	req, err := retryablehttp.NewRequest("GET", uri+urn+"Session", nil)
+// DownloadAttachmentTo copies attachment attachmentId into w.
+func (c *Client) DownloadAttachmentTo(ctx context.Context, attachmentId int, w io.Writer) (AttachmentInfo, error) {
+	dl, err := c.DownloadAttachment(ctx, attachmentId)
 	if err != nil {
-		return 0, err
+		return AttachmentInfo{}, err
 	}
-	req.Header.Set("accept", "application/json")
-	WrapAuth(req, user)
+	defer dl.Body.Close()
 
-	client := &http.Client{
-		Timeout: time.Second * 30,
-		Jar:     cookieJar,
+	if _, err := io.Copy(w, dl.Body); err != nil {
+		return dl.AttachmentInfo, err
 	}
 
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	return dl.AttachmentInfo, nil
+}
+
+// DownloadTicketAttachments saves every attachment of ticket and of its notes
+// into dir, and returns the paths written. Files are named after the
+// attachment; a name already taken is prefixed with the attachment id.
+func (c *Client) DownloadTicketAttachments(ctx context.Context, ticket Ticket, dir string) ([]string, error) {
+	atts := append([]Attachment(nil), ticket.Attachments...)
+	for _, note := range ticket.Notes {
+		atts = append(atts, note.Attachments...)
+	}
+
+	seen := make(map[int]bool)
+	taken := make(map[string]bool)
+	paths := make([]string, 0, len(atts))
+
+	for _, att := range atts {
+		if seen[att.Id] {
+			continue
+		}
+		seen[att.Id] = true
+
+		name := filepath.Base(att.FileName)
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			name = fmt.Sprintf("attachment-%d", att.Id)
+		}
+		if taken[name] {
+			name = fmt.Sprintf("%d-%s", att.Id, name)
 		}
-		client.Transport = tr
+		taken[name] = true
+
+		path := filepath.Join(dir, name)
+		if err := c.downloadAttachmentToFile(ctx, att.Id, path); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = RETRY_MAX
-	retryclient.HTTPClient = client
+	return paths, nil
+}
 
-	resp, err := retryclient.Do(req)
+func (c *Client) downloadAttachmentToFile(ctx context.Context, attachmentId int, path string) error {
+	file, err := os.Create(path)
 	if err != nil {
-		log.Printf("The HTTP request failed with error %s\n", err)
-		return 0, err
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("error getting session key: bad status: %s", resp.Status)
+	if _, err := c.DownloadAttachmentTo(ctx, attachmentId, file); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
 	}
 
-	data, _ := ioutil.ReadAll(resp.Body)
-	log.Printf("session key resp: %s\n", data)
+	return file.Close()
+}
 
-	var dataMap map[string]interface{}
-	if err := json.Unmarshal(data, &dataMap); err != nil {
-		log.Println("error unmarshalling: ", err)
-		return 0, err
-	}
+func UploadAttachment(uri string, user User, ticketId int, filename string, filedata []byte, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).UploadAttachment(context.Background(), ticketId, filename, filedata)
+}
 
-	sessionKey, ok := dataMap["sessionKey"].(string)
-	if !ok {
-		log.Println("invalid sessionKey in map")
-		return 0, err
-	}
-	log.Printf("sessionKey retrieved: %s", sessionKey)
+func UploadAttachmentToNote(uri string, user User, noteId int, filename string, filedata []byte, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).UploadAttachmentToNote(context.Background(), noteId, filename, filedata)
+}
 
-	// Upload attachment
-	cookies := cookieJar.Cookies(req.URL)
+func UploadAttachmentToNoteFromFile(uri string, user User, noteId int, filename string, fullFilePath string, deleteFileAfter bool, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).UploadAttachmentToNoteFromFile(context.Background(), noteId, filename, fullFilePath, deleteFileAfter)
+}
 
-	for _, cookie := range resp.Cookies() {
-		if cookie.Name == "JSESSIONID" {
-			log.Printf("Add JSESSIONID cookie to request")
-			cookies = append(cookies, &http.Cookie{
-				Name:  "JSESSIONID",
-				Value: cookie.Value,
-				//Path:   "/helpdesk",
-				//Domain: host,
-			})
-		}
-	}
+func UploadAttachmentToTicketFromFile(uri string, user User, ticketId int, filename string, fullFilePath string, deleteFileAfter bool, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).UploadAttachmentToTicketFromFile(context.Background(), ticketId, filename, fullFilePath, deleteFileAfter)
+}
 
-	log.Printf("Cookies: %+v", cookies)
-	cookies = append(cookies, &http.Cookie{
-		Name:  "wosid",
-		Value: sessionKey,
-		Path:  "/",
-		//Domain: host,
-	})
+func UploadAttachmentToEntity(uri string, user User, entity string, entityId int, filename string, filedata []byte, sslVerify bool) (int, error) {
+	return NewClient(uri, user, WithSSLVerify(sslVerify)).UploadAttachmentToEntity(context.Background(), entity, entityId, filename, filedata)
+}
 
-	log.Printf("Cookies with wosid: %+v", cookies)
+func (c *Client) UploadAttachment(ctx context.Context, ticketId int, filename string, filedata []byte) (int, error) {
+	return c.UploadAttachmentToEntity(ctx, "jobTicket", ticketId, filename, filedata)
+}
 
-	// check if tmp directory exists and create it
-	if _, err := os.Stat("tmp"); os.IsNotExist(err) {
-		err := os.Mkdir("tmp", os.ModeDir|os.ModeSetuid|os.ModeSetgid|0777)
-		if err != nil {
-			return 0, fmt.Errorf("Unable to create tmp directory to store attachments: %s", err)
-		}
-	}
+func (c *Client) UploadAttachmentToNote(ctx context.Context, noteId int, filename string, filedata []byte) (int, error) {
+	return c.UploadAttachmentToEntity(ctx, "techNote", noteId, filename, filedata)
+}
 
-	// save file
-	filename = filepath.FromSlash("tmp/" + filename) // save in tmp directory
-	err = ioutil.WriteFile(filename, filedata, 0644)
+func (c *Client) UploadAttachmentToNoteFromFile(ctx context.Context, noteId int, filename string, fullFilePath string, deleteFileAfter bool) (int, error) {
+	return c.uploadAttachmentFromFile(ctx, "techNote", noteId, filename, fullFilePath, deleteFileAfter)
+}
+
+func (c *Client) UploadAttachmentToTicketFromFile(ctx context.Context, ticketId int, filename string, fullFilePath string, deleteFileAfter bool) (int, error) {
+	return c.uploadAttachmentFromFile(ctx, "jobTicket", ticketId, filename, fullFilePath, deleteFileAfter)
+}
+
+func (c *Client) uploadAttachmentFromFile(ctx context.Context, entity string, entityId int, filename string, fullFilePath string, deleteFileAfter bool) (int, error) {
+	// stream the file rather than reading it in
+	file, err := os.Open(fullFilePath)
 	if err != nil {
-		log.Println("unable to save file")
-		return 0, err
+		return 0, fmt.Errorf("whd: unable to read attachment file: %w", err)
 	}
-	file, err := os.Open(filename)
+	defer file.Close()
+
+	info, err := file.Stat()
 	if err != nil {
-		log.Println("unable to read file")
-		return 0, err
+		return 0, fmt.Errorf("whd: unable to read attachment file: %w", err)
 	}
-	defer file.Close()
 
-	// Prepare a form that you will submit to that URL.
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", filepath.Base(filename))
+	attId, err := c.UploadAttachmentReader(ctx, entity, entityId, filename, file, info.Size())
+
 	if err != nil {
 		return 0, err
 	}
-	_, err = io.Copy(part, file)
 
-	err = writer.Close()
+	if deleteFileAfter {
+		os.Remove(fullFilePath)
+	}
+
+	return attId, nil
+}
+
+func (c *Client) UploadAttachmentToEntity(ctx context.Context, entity string, entityId int, filename string, filedata []byte) (int, error) {
+	return c.UploadAttachmentReader(ctx, entity, entityId, filename, bytes.NewReader(filedata), int64(len(filedata)))
+}
+
+// UploadAttachmentReader uploads the content of r as filename and attaches it
+// to the entity ("jobTicket" or "techNote") with id entityId. The multipart
+// body is streamed straight from r to WHD, so nothing is written to disk and
+// the file is never held in memory.
+//
+// size is the number of bytes r will yield, used to send a Content-Length;
+// pass -1 when it is not known and the body is sent chunked. As r cannot be
+// replayed the upload itself is not retried, and it is not subject to the
+// Client timeout: bound it with ctx instead.
+func (c *Client) UploadAttachmentReader(ctx context.Context, entity string, entityId int, filename string, r io.Reader, size int64) (int, error) {
+	sessionKey, cookieJar, err := c.uploadSession(ctx)
 	if err != nil {
 		return 0, err
 	}
+	if !isSessionKeyAuth(c.auth) {
+		defer func() {
+			// the upload session is only good for this upload, end it even
+			// if ctx was cancelled
+			if err := c.TerminateSession(context.WithoutCancel(ctx), sessionKey); err != nil {
+				c.logger.WarnContext(ctx, "could not terminate attachment upload session", "error", err)
+			}
+		}()
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	filename = filepath.Base(filename)
 
-	writer.WriteField("wosid", sessionKey)
+	go func() {
+		part, err := writer.CreateFormFile("file", filename)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
 
-	//log.Printf("Body: %+v", body)
-	postUrl := fmt.Sprintf("%s/helpdesk/attachment/upload", uri)
-	log.Printf("Sending Attachment POST to: %s", postUrl)
-	req2, err := retryablehttp.NewRequest("POST", postUrl, body)
+	postUrl := fmt.Sprintf("%s/helpdesk/attachment/upload", c.uri)
+	req, err := http.NewRequestWithContext(ctx, "POST", postUrl, pr)
 	if err != nil {
+		pr.Close()
 		return 0, err
 	}
-	cookieJar.SetCookies(req2.URL, cookies)
-	client2 := &http.Client{
-		Jar:     cookieJar,
-		Timeout: time.Second * 120,
-	}
 
-	if !sslVerify {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	if size >= 0 {
+		overhead, err := multipartOverhead(writer.Boundary(), filename)
+		if err != nil {
+			pr.Close()
+			return 0, err
 		}
-		client2.Transport = tr
+		req.ContentLength = overhead + size
 	}
 
-	req2.Header.Set("User-Agent", "Java/1.7.0_55")
-	req2.Header.Set("accept", "application/json")
-	req2.Header.Set("Pragma", "no-cache")
-	req2.Header.Set("Cache-Control", "no-cache")
-	req2.Header.Set("Connection", "keep-alive")
-	req2.Header.Set("Accept", "text/html,image/gif,image/jpeg,*;q=.2,*/*;q=.2")
+	req.Header.Set("User-Agent", "Java/1.7.0_55")
+	req.Header.Set("Pragma", "no-cache")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Connection", "keep-alive")
+	req.Header.Set("Accept", "text/html,image/gif,image/jpeg,*;q=.2,*/*;q=.2")
 	// Don't forget to set the content type, this will contain the boundary.
-	req2.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	q := req2.URL.Query()
+	q := req.URL.Query()
 
 	q.Add("type", entity)
 	q.Add("entityId", fmt.Sprintf("%d", entityId))
 	q.Add("returnFields", "id")
 	q.Add("sessionKey", sessionKey)
 
-	// q.Add("subscriberId", "2")
-
-	req2.URL.RawQuery = q.Encode()
+	req.URL.RawQuery = q.Encode()
 
-	// WrapAuth(req2, User{
-	// 	Name: user.Name,
-	// 	Pass: sessionKey,
-	// 	Type: SessionKeyAuth,
-	// })
+	if err := c.applyProxyAuth(req); err != nil {
+		pr.Close()
+		return 0, err
+	}
 
-	log.Printf("Sending Attachment POST to: %+v", req2.URL)
+	c.logger.DebugContext(ctx, "sending attachment upload", "url", redactURL(req.URL), "size", size)
 
-	retryclient2 := retryablehttp.NewClient()
-	retryclient2.RetryMax = RETRY_MAX
-	retryclient2.HTTPClient = client2
+	client := &http.Client{
+		Transport: c.httpClient.Transport,
+		Jar:       cookieJar,
+	}
 
-	resp2, err := retryclient2.Do(req2)
+	release, err := c.limits.acquire(ctx)
 	if err != nil {
-		log.Printf("The HTTP request failed when uploading attachment: %s\n", err)
+		pr.Close()
 		return 0, err
 	}
-	defer resp.Body.Close()
+	defer release()
 
-	// if resp2.StatusCode != http.StatusOK {
-	// 	err = fmt.Errorf("error uploading attachment: bad status: %s", resp2.Status)
-	// 	return 0, err
-	// }
+	resp, err := client.Do(req)
+	if err != nil {
+		pr.Close()
+		c.logRequestFailed(ctx, req, err)
+		return 0, redactError(err)
+	}
+	defer resp.Body.Close()
 
-	data2, _ := ioutil.ReadAll(resp2.Body)
-	log.Printf("attachment upload response(%d): %s", resp2.StatusCode, string(data2))
-	var dataMap2 map[string]interface{}
-	if err := json.Unmarshal(data2, &dataMap2); err != nil {
-		log.Println("error unmarshalling att upload response: ", err)
+	data, _ := ioutil.ReadAll(resp.Body)
+	c.logger.DebugContext(ctx, "attachment upload response", "status", resp.StatusCode, "body", string(data))
+	var dataMap map[string]interface{}
+	if err := json.Unmarshal(data, &dataMap); err != nil {
+		c.logger.ErrorContext(ctx, "error unmarshalling attachment upload response", "error", err)
+		if resp.StatusCode != http.StatusOK {
+			return 0, newAPIError(req, resp.StatusCode, data)
+		}
 		return 0, err
 	}
 
-	attIdFloat, ok := dataMap2["id"].(float64)
+	attIdFloat, ok := dataMap["id"].(float64)
 	if !ok {
-		reasonStr, ok := dataMap2["reason"].(string)
+		reasonStr, ok := dataMap["reason"].(string)
 		if !ok {
-			log.Println("invalid attachment id in map")
 			return 0, fmt.Errorf("Invalid attachment id in response")
 		}
 
-		log.Printf("Unable to Upload Attachment: %s", reasonStr)
-		return 0, fmt.Errorf("Unable to upload attachment: %s", reasonStr)
+		c.logger.WarnContext(ctx, "unable to upload attachment", "reason", reasonStr)
+		return 0, newAPIError(req, resp.StatusCode, data)
 	}
 
 	return int(attIdFloat), nil
 }
+
+// uploadSession opens the WHD session the attachment upload servlet needs. It
+// returns the session key and a cookie jar holding the JSESSIONID and wosid
+// cookies identifying the session.
+func (c *Client) uploadSession(ctx context.Context) (string, *cookiejar.Jar, error) {
+	cookieJar, _ := cookiejar.New(nil)
+
+	// get session key to get JSESSIONID and wosid
+	req, err := c.newLoginRequest(ctx, "GET", "Session", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := c.login(req); err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("accept", "application/json")
+
+	release, err := c.limits.acquire(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
+
+	resp, err := c.newJarClient(cookieJar).Do(req)
+	if err != nil {
+		c.logRequestFailed(ctx, req.Request, err)
+		return "", nil, redactError(err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, newAPIError(req.Request, resp.StatusCode, data)
+	}
+
+	var dataMap map[string]interface{}
+	if err := json.Unmarshal(data, &dataMap); err != nil {
+		c.logger.ErrorContext(ctx, "error unmarshalling session response", "error", err)
+		return "", nil, err
+	}
+
+	sessionKey, ok := dataMap["sessionKey"].(string)
+	if !ok {
+		return "", nil, fmt.Errorf("whd: no sessionKey in Session response")
+	}
+	c.logger.DebugContext(ctx, "session key retrieved for attachment upload")
+
+	cookies := cookieJar.Cookies(req.URL)
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "JSESSIONID" {
+			cookies = append(cookies, &http.Cookie{
+				Name:  "JSESSIONID",
+				Value: cookie.Value,
+			})
+		}
+	}
+
+	cookies = append(cookies, &http.Cookie{
+		Name:  "wosid",
+		Value: sessionKey,
+		Path:  "/",
+	})
+
+	c.logger.DebugContext(ctx, "attachment upload cookies", "cookies", cookieNames(cookies))
+
+	uploadUrl, _ := url.Parse(c.uri + "/helpdesk/attachment/upload")
+	cookieJar.SetCookies(uploadUrl, cookies)
+
+	return sessionKey, cookieJar, nil
+}
+
+// multipartOverhead returns the number of bytes a multipart body holding a
+// single file part adds around the file content.
+func multipartOverhead(boundary string, filename string) (int64, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return 0, err
+	}
+	if _, err := writer.CreateFormFile("file", filename); err != nil {
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
@@ -0,0 +1,336 @@
+package whd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestDeleteTickets(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 120; i++ {
+		subject := "keep"
+		if i%4 == 0 {
+			subject = "spam"
+		}
+		srv.AddTicket(whd.Ticket{Subject: subject})
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	// more matches than a page, deleting as the pages are read would skip some
+	ids, err := c.DeleteTickets(ctx, "(subject = 'spam')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 30 {
+		t.Errorf("deleted %d tickets, want 30", len(ids))
+	}
+	for _, id := range ids {
+		if ticket, _ := srv.Ticket(id); !ticket.Deleted || ticket.Subject != "spam" {
+			t.Errorf("ticket %d: got %+v, want a deleted spam ticket", id, ticket)
+		}
+	}
+
+	ids, err = c.RestoreTickets(ctx, "(subject = 'spam')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 30 {
+		t.Errorf("restored %d tickets, want 30", len(ids))
+	}
+}
+
+func TestDeleteTicketsBlankQualifier(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	for _, q := range []string{"", "  "} {
+		ids, err := c.DeleteTickets(context.Background(), q)
+		if !errors.Is(err, whd.ErrValidation) || len(ids) != 0 {
+			t.Errorf("DeleteTickets(%q) = %v, %v, want ErrValidation", q, ids, err)
+		}
+	}
+	if ticket, _ := srv.Ticket(id); ticket.Deleted {
+		t.Error("a blank qualifier deleted a ticket")
+	}
+}
+
+func TestDeleteTicketsPartialFailure(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	for i := 0; i < 3; i++ {
+		srv.AddTicket(whd.Ticket{Subject: "spam"})
+	}
+	srv.Fail(whdtest.Failure{Method: "DELETE", Path: "Ticket/2"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	ids, err := c.DeleteTickets(context.Background(), "(subject = 'spam')")
+	if err == nil {
+		t.Fatal("got no error from the failed delete")
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("got %v, want the ids deleted before the failure", ids)
+	}
+}
+
+func TestRestoreTicketsOnlyDeleted(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	live := srv.AddTicket(whd.Ticket{Subject: "a"})
+	gone := srv.AddTicket(whd.Ticket{Subject: "b", Deleted: true})
+	c := srv.Client(whd.WithLogger(nil))
+
+	ids, err := c.RestoreTickets(ctx, "(subject = 'a') or (subject = 'b')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != gone {
+		t.Errorf("restored %v, want only the deleted ticket %d", ids, gone)
+	}
+	if ticket, _ := srv.Ticket(live); ticket.Deleted {
+		t.Error("the live ticket was touched")
+	}
+}
+
+func TestDownloadTicketAttachments(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	files := []struct {
+		name string
+		want string // file written, relative to the download directory
+	}{
+		{"report.pdf", "report.pdf"},
+		{"report.pdf", "2-report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{"..", "attachment-4"},
+		{".", "attachment-5"},
+		{"", "attachment-6"},
+	}
+	for _, f := range files {
+		srv.AddAttachment(id, f.name, []byte(f.name))
+	}
+
+	c := srv.Client(whd.WithLogger(nil))
+	var ticket whd.Ticket
+	if err := c.GetTicket(ctx, id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "downloads")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := c.DownloadTicketAttachments(ctx, ticket, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.want)
+		if !slices.Contains(paths, path) {
+			t.Errorf("attachment %q: %s not in %v", f.name, path, paths)
+			continue
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != f.name {
+			t.Errorf("attachment %q: read %q, %v from %s", f.name, data, err, path)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("got %d entries next to the download directory, want none", len(entries)-1)
+	}
+}
+
+func TestUpdateTicketIfUnchanged(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	var stale whd.Ticket
+	if err := c.GetTicket(ctx, id, &stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateUpdateTicket(ctx, whd.Ticket{Id: id, Detail: "theirs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stale.Detail = "mine"
+	_, err := c.UpdateTicketIfUnchanged(ctx, stale)
+	var conflict *whd.ConflictError
+	if !errors.Is(err, whd.ErrConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("got %v, want a ConflictError", err)
+	}
+	if conflict.Id != id || conflict.Current.Detail != "theirs" || !conflict.Expected.Equal(stale.LastUpdated) {
+		t.Errorf("got conflict %+v, want the current ticket", conflict)
+	}
+	if ticket, _ := srv.Ticket(id); ticket.Detail != "theirs" {
+		t.Errorf("got detail %q, want the stale update not sent", ticket.Detail)
+	}
+
+	current := conflict.Current
+	current.Detail = "mine"
+	if _, err := c.UpdateTicketIfUnchanged(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if ticket, _ := srv.Ticket(id); ticket.Detail != "mine" {
+		t.Errorf("got detail %q, want the update applied", ticket.Detail)
+	}
+
+	if _, err := c.UpdateTicketIfUnchanged(ctx, whd.Ticket{Id: id}); !errors.Is(err, whd.ErrValidation) {
+		t.Errorf("got %v for a ticket without LastUpdated, want ErrValidation", err)
+	}
+}
+
+func TestUpdateTicketWithMerge(t *testing.T) {
+	errMerge := errors.New("merge failed")
+
+	tests := []struct {
+		name        string
+		writes      int // concurrent writes landing while merge runs
+		maxAttempts int
+		mergeErr    error
+		wantErr     error
+		wantCalls   int
+		wantDetail  string
+	}{
+		{"unchanged", 0, 0, nil, nil, 1, "+mine"},
+		{"merged again", 2, 3, nil, nil, 3, "+theirs+theirs+mine"},
+		{"default attempts", 2, 0, nil, nil, 3, "+theirs+theirs+mine"},
+		{"gives up", 3, 3, nil, whd.ErrConflict, 3, "+theirs+theirs+theirs"},
+		{"merge error", 0, 3, errMerge, errMerge, 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			id := srv.AddTicket(whd.Ticket{Subject: "s"})
+			c := srv.Client(whd.WithLogger(nil))
+
+			calls := 0
+			_, err := c.UpdateTicketWithMerge(context.Background(), id, tt.maxAttempts, func(ticket *whd.Ticket) error {
+				calls++
+				if calls <= tt.writes {
+					// another client updates the ticket after it was read
+					theirs, _ := srv.Ticket(id)
+					theirs.Detail += "+theirs"
+					srv.AddTicket(theirs)
+				}
+				ticket.Detail += "+mine"
+				return tt.mergeErr
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("merge called %d times, want %d", calls, tt.wantCalls)
+			}
+			if ticket, _ := srv.Ticket(id); ticket.Detail != tt.wantDetail {
+				t.Errorf("got detail %q, want %q", ticket.Detail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestUploadAttachmentStreamed(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64<<10) // 1 MiB
+	path := filepath.Join(t.TempDir(), "a.bin")
+	// hides the size of a bytes.Reader from net/http
+	reader := func() io.Reader { return struct{ io.Reader }{bytes.NewReader(data)} }
+
+	tests := []struct {
+		name    string
+		upload  func(ctx context.Context, c *whd.Client, id int) (int, error)
+		chunked bool
+	}{
+		{"known size", func(ctx context.Context, c *whd.Client, id int) (int, error) {
+			return c.UploadAttachmentReader(ctx, "jobTicket", id, "a.bin", reader(), int64(len(data)))
+		}, false},
+		{"unknown size", func(ctx context.Context, c *whd.Client, id int) (int, error) {
+			return c.UploadAttachmentReader(ctx, "jobTicket", id, "a.bin", reader(), -1)
+		}, true},
+		{"from file", func(ctx context.Context, c *whd.Client, id int) (int, error) {
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			return c.UploadAttachmentToTicketFromFile(ctx, id, "a.bin", path, true)
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			// nothing is buffered to disk on the way
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+
+			ticket := srv.AddTicket(whd.Ticket{Subject: "s"})
+			c := srv.Client(whd.WithLogger(nil))
+
+			id, err := tt.upload(context.Background(), c, ticket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, got, _ := srv.Attachment(id); !bytes.Equal(got, data) {
+				t.Errorf("got %d bytes uploaded, want %d", len(got), len(data))
+			}
+
+			for _, r := range srv.Requests() {
+				if r.Method != "POST" {
+					continue
+				}
+				if chunked := r.ContentLength == -1; chunked != tt.chunked {
+					t.Errorf("sent Content-Length %d, want chunked %v", r.ContentLength, tt.chunked)
+				}
+			}
+			if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+				t.Errorf("got %d temporary files", len(entries))
+			}
+		})
+	}
+}
+
+func TestUploadAttachmentMissingFile(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	ticket := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil))
+
+	path := filepath.Join(t.TempDir(), "missing.txt")
+	_, err := c.UploadAttachmentToTicketFromFile(context.Background(), ticket, "missing.txt", path, false)
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "attachment file") {
+		t.Errorf("got %v, want the missing attachment file reported", err)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("sent %d requests for a missing file", n)
+	}
+}
@@ -0,0 +1,88 @@
+package whd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// WithTLSConfig sets the TLS configuration every request is made with, the
+// attachment upload included. The other TLS options are applied on top of a
+// copy of it, and WithSSLVerify(false) still turns verification off.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithRootCAs sets the certificate authorities the WHD server certificate is
+// verified against, instead of the system pool. See LoadCABundle.
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(c *Client) {
+		c.rootCAs = pool
+	}
+}
+
+// WithClientCertificates presents certs to servers asking for a client
+// certificate (mutual TLS). Load them with tls.LoadX509KeyPair.
+func WithClientCertificates(certs ...tls.Certificate) ClientOption {
+	return func(c *Client) {
+		c.clientCerts = append(c.clientCerts, certs...)
+	}
+}
+
+// WithMinTLSVersion sets the lowest TLS version accepted, e.g. tls.VersionTLS12.
+func WithMinTLSVersion(version uint16) ClientOption {
+	return func(c *Client) {
+		c.minTLSVersion = version
+	}
+}
+
+// LoadCABundle reads the PEM encoded certificates in the file at path into a
+// pool for WithRootCAs. It fails if the file holds no certificate.
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("whd: reading CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("whd: no PEM certificate in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// newTLSConfig combines the TLS options of the Client. It returns nil when
+// none is set, leaving the transport's default.
+func (c *Client) newTLSConfig() *tls.Config {
+	if !c.hasTLSOptions() && c.sslVerify {
+		return nil
+	}
+
+	config := &tls.Config{}
+	if c.tlsConfig != nil {
+		config = c.tlsConfig.Clone()
+	}
+	if c.rootCAs != nil {
+		config.RootCAs = c.rootCAs
+	}
+	if len(c.clientCerts) > 0 {
+		config.Certificates = append(config.Certificates, c.clientCerts...)
+	}
+	if c.minTLSVersion != 0 {
+		config.MinVersion = c.minTLSVersion
+	}
+	if !c.sslVerify {
+		config.InsecureSkipVerify = true
+	}
+
+	return config
+}
+
+// hasTLSOptions reports whether a TLS option other than WithSSLVerify is set.
+func (c *Client) hasTLSOptions() bool {
+	return c.tlsConfig != nil || c.rootCAs != nil || len(c.clientCerts) > 0 ||
+		c.minTLSVersion != 0
+}
@@ -0,0 +1,130 @@
+package whd_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+// writePEM writes certs to a CA bundle file and returns its path.
+func writePEM(t *testing.T, certs ...*x509.Certificate) string {
+	t.Helper()
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// otherCA returns a self-signed CA certificate that did not sign the
+// whdtest certificate.
+func otherCA(t *testing.T) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCABundle(t *testing.T) {
+	srv := whdtest.NewTLSServer()
+	defer srv.Close()
+	// the rejected handshakes are expected
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+
+	tests := []struct {
+		name    string
+		bundle  []*x509.Certificate // nil uses the system pool
+		wantErr bool
+	}{
+		{"server CA", []*x509.Certificate{srv.Certificate()}, false},
+		{"among other CAs", []*x509.Certificate{otherCA(t), srv.Certificate()}, false},
+		{"other CA", []*x509.Certificate{otherCA(t)}, true},
+		{"system pool", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			opts := []whd.ClientOption{whd.WithLogger(nil), whd.WithRetryMax(0)}
+			if tt.bundle != nil {
+				pool, err := whd.LoadCABundle(writePEM(t, tt.bundle...))
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts = append(opts, whd.WithRootCAs(pool))
+			}
+			c := whd.NewClient(srv.URL, srv.User(), opts...)
+
+			var ticket whd.Ticket
+			err := c.GetTicket(ctx, id, &ticket)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetTicket: got %v, want error %v", err, tt.wantErr)
+			}
+			// the upload servlet is reached with its own HTTP client
+			_, err = c.UploadAttachment(ctx, id, "a.txt", []byte("hello"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UploadAttachment: got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, data, ok := srv.Attachment(1); !ok || string(data) != "hello" {
+		t.Errorf("got attachment %q, want the upload over TLS", data)
+	}
+	if _, _, ok := srv.Attachment(3); ok {
+		t.Error("an upload went through with an untrusted certificate")
+	}
+}
+
+func TestLoadCABundleError(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{notPEM, filepath.Join(dir, "missing.pem")} {
+		if _, err := whd.LoadCABundle(path); err == nil {
+			t.Errorf("LoadCABundle(%s): got no error", path)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package whdtest
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// predicate reports whether a stored record matches a qualifier.
+type predicate func(record map[string]interface{}) bool
+
+// parseQualifier parses the qualifier syntax produced by the qualifier package
+// (and written by hand in WHD's documentation): comparisons of a key path with
+// a literal, combined with and, or, not and parentheses.
+func parseQualifier(s string) (predicate, error) {
+	if strings.TrimSpace(s) == "" {
+		return func(map[string]interface{}) bool { return true }, nil
+	}
+
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q in qualifier", p.toks[p.pos].text)
+	}
+	return pred, nil
+}
+
+type tokenKind int
+
+const (
+	tokParen tokenKind = iota
+	tokWord
+	tokOp
+	tokString
+	tokNumber
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	rs := []rune(s)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			toks = append(toks, token{tokParen, string(r)})
+			i++
+		case r == '\'' || r == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(rs) && rs[j] != r; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("unterminated string in qualifier")
+			}
+			toks = append(toks, token{tokString, sb.String()})
+			i = j + 1
+		case strings.ContainsRune("=!<>", r):
+			j := i + 1
+			if j < len(rs) && rs[j] == '=' {
+				j++
+			}
+			toks = append(toks, token{tokOp, string(rs[i:j])})
+			i = j
+		case r == '-' || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, string(rs[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokWord, string(rs[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q in qualifier", r)
+		}
+	}
+
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peekWord(word string) bool {
+	return p.pos < len(p.toks) && p.toks[p.pos].kind == tokWord && strings.EqualFold(p.toks[p.pos].text, word)
+}
+
+func (p *parser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r map[string]interface{}) bool { return l(r) || right(r) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r map[string]interface{}) bool { return l(r) && right(r) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (predicate, error) {
+	if p.peekWord("not") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(r map[string]interface{}) bool { return !inner(r) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (predicate, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("unexpected end of qualifier")
+	}
+
+	if p.toks[p.pos].kind == tokParen && p.toks[p.pos].text == "(" {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].text != ")" {
+			return nil, fmt.Errorf("missing ) in qualifier")
+		}
+		p.pos++
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (predicate, error) {
+	if p.pos+3 > len(p.toks) {
+		return nil, fmt.Errorf("incomplete comparison in qualifier")
+	}
+
+	key := p.toks[p.pos]
+	op := p.toks[p.pos+1]
+	val := p.toks[p.pos+2]
+	p.pos += 3
+
+	if key.kind != tokWord {
+		return nil, fmt.Errorf("expected a key in qualifier, got %q", key.text)
+	}
+
+	var operator string
+	switch {
+	case op.kind == tokOp:
+		operator = op.text
+	case op.kind == tokWord && (strings.EqualFold(op.text, "like") || strings.EqualFold(op.text, "caseInsensitiveLike")):
+		operator = strings.ToLower(op.text)
+	default:
+		return nil, fmt.Errorf("unknown operator %q in qualifier", op.text)
+	}
+
+	var literal interface{}
+	switch val.kind {
+	case tokString:
+		literal = val.text
+	case tokNumber:
+		f, err := strconv.ParseFloat(val.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q in qualifier", val.text)
+		}
+		literal = f
+	case tokWord:
+		switch strings.ToLower(val.text) {
+		case "null", "nil":
+			literal = nil
+		case "true":
+			literal = float64(1)
+		case "false":
+			literal = float64(0)
+		default:
+			return nil, fmt.Errorf("unexpected %q in qualifier", val.text)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected %q in qualifier", val.text)
+	}
+
+	cmp, err := comparator(operator, literal)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.Split(key.text, ".")
+	return func(r map[string]interface{}) bool {
+		vals := lookup(r, path)
+		if len(vals) == 0 {
+			vals = []interface{}{nil}
+		}
+		// a path through a to-many relation matches if any element does
+		for _, v := range vals {
+			if cmp(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func comparator(op string, literal interface{}) (func(v interface{}) bool, error) {
+	switch op {
+	case "like", "caseinsensitivelike":
+		pattern, ok := literal.(string)
+		if !ok {
+			return nil, fmt.Errorf("like needs a string pattern")
+		}
+		expr := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern)) + "$"
+		if op == "caseinsensitivelike" {
+			expr = "(?i)" + expr
+		}
+		re := regexp.MustCompile(expr)
+		return func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && re.MatchString(s)
+		}, nil
+	case "=", "==":
+		return func(v interface{}) bool { return compareValues(v, literal) == 0 }, nil
+	case "!=", "<>":
+		return func(v interface{}) bool { return compareValues(v, literal) != 0 }, nil
+	case "<":
+		return func(v interface{}) bool { return ordered(v, literal) && compareValues(v, literal) < 0 }, nil
+	case "<=":
+		return func(v interface{}) bool { return ordered(v, literal) && compareValues(v, literal) <= 0 }, nil
+	case ">":
+		return func(v interface{}) bool { return ordered(v, literal) && compareValues(v, literal) > 0 }, nil
+	case ">=":
+		return func(v interface{}) bool { return ordered(v, literal) && compareValues(v, literal) >= 0 }, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q in qualifier", op)
+}
+
+// ordered reports whether v and literal can be ordered: null never compares.
+func ordered(v interface{}, literal interface{}) bool {
+	return v != nil && literal != nil
+}
+
+// compareValues orders a stored JSON value against a qualifier literal. Null
+// only equals null, booleans compare as 1 and 0, and mismatched types compare
+// as their string forms.
+func compareValues(v interface{}, literal interface{}) int {
+	if v == nil || literal == nil {
+		if v == nil && literal == nil {
+			return 0
+		}
+		return 1
+	}
+
+	if b, ok := v.(bool); ok {
+		if b {
+			v = float64(1)
+		} else {
+			v = float64(0)
+		}
+	}
+
+	switch l := literal.(type) {
+	case float64:
+		f, ok := v.(float64)
+		if !ok {
+			var err error
+			if f, err = strconv.ParseFloat(fmt.Sprint(v), 64); err != nil {
+				return strings.Compare(fmt.Sprint(v), fmt.Sprint(l))
+			}
+		}
+		switch {
+		case f < l:
+			return -1
+		case f > l:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(fmt.Sprint(v), l)
+	}
+	return strings.Compare(fmt.Sprint(v), fmt.Sprint(literal))
+}
+
+// lookup follows path through nested objects, fanning out over arrays.
+func lookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		if arr, ok := v.([]interface{}); ok {
+			return arr
+		}
+		return []interface{}{v}
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		next, ok := t[path[0]]
+		if !ok {
+			return nil
+		}
+		return lookup(next, path[1:])
+	case []interface{}:
+		var out []interface{}
+		for _, e := range t {
+			out = append(out, lookup(e, path)...)
+		}
+		return out
+	}
+	return nil
+}
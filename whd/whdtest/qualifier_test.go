@@ -0,0 +1,127 @@
+package whdtest
+
+import (
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []token
+	}{
+		{"(subject = 'a b')", []token{{tokParen, "("}, {tokWord, "subject"}, {tokOp, "="}, {tokString, "a b"}, {tokParen, ")"}}},
+		{"id>=-12.5", []token{{tokWord, "id"}, {tokOp, ">="}, {tokNumber, "-12.5"}}},
+		{`name != 'it\'s'`, []token{{tokWord, "name"}, {tokOp, "!="}, {tokString, "it's"}}},
+		{`name = "x"`, []token{{tokWord, "name"}, {tokOp, "="}, {tokString, "x"}}},
+		{"statustype.statusTypeName like 'Op*'", []token{{tokWord, "statustype.statusTypeName"}, {tokWord, "like"}, {tokString, "Op*"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := tokenize(tt.in)
+		if err != nil {
+			t.Errorf("tokenize(%q): %v", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("tokenize(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("tokenize(%q)[%d] = %v, want %v", tt.in, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseQualifier(t *testing.T) {
+	record := map[string]interface{}{
+		"id":      float64(7),
+		"subject": "Printer on fire",
+		"deleted": false,
+		"detail":  nil,
+		"statustype": map[string]interface{}{
+			"id":             float64(2),
+			"statusTypeName": "Open",
+		},
+		"assets": []interface{}{
+			map[string]interface{}{"id": float64(10), "assetNumber": "A-1"},
+			map[string]interface{}{"id": float64(11), "assetNumber": "B-2"},
+		},
+		"ticketCustomFields": []interface{}{
+			map[string]interface{}{"definitionId": float64(3), "restValue": "alert-9"},
+		},
+	}
+
+	tests := []struct {
+		qualifier string
+		want      bool
+	}{
+		{"", true},
+		{"   ", true},
+		{"(id = 7)", true},
+		{"(id = 8)", false},
+		{"(id != 8)", true},
+		{"(id < 10)", true},
+		{"(id <= 7)", true},
+		{"(id > 7)", false},
+		{"(id >= 7.0)", true},
+		{"(subject = 'Printer on fire')", true},
+		{"(subject = 'printer on fire')", false},
+		{"(subject like 'Printer*')", true},
+		{"(subject like 'printer*')", false},
+		{"(subject caseInsensitiveLike 'printer*')", true},
+		{"(subject like 'Printer on fir?')", true},
+		{"(subject like 'Print.*')", false},
+		{"(deleted = 0)", true},
+		{"(deleted = false)", true},
+		{"(deleted = 1)", false},
+		{"(detail = null)", true},
+		{"(detail != null)", false},
+		{"(detail < 5)", false},
+		{"(missing = null)", true},
+		{"(statustype.statusTypeName = 'Open')", true},
+		{"(statustype.id != 2)", false},
+		{"(assets.assetNumber = 'B-2')", true},
+		{"(assets.id = 12)", false},
+		{"(ticketCustomFields.restValue = 'alert-9')", true},
+		{"(id = 7) and (subject like 'X*')", false},
+		{"(id = 7) or (subject like 'X*')", true},
+		{"not (id = 7)", false},
+		{"NOT (id = 8) AND (id = 7)", true},
+		// and binds tighter than or
+		{"(id = 1) or (id = 7) and (deleted = 1)", false},
+		{"((id = 1) or (id = 7)) and (deleted = 0)", true},
+	}
+
+	for _, tt := range tests {
+		pred, err := parseQualifier(tt.qualifier)
+		if err != nil {
+			t.Errorf("parseQualifier(%q): %v", tt.qualifier, err)
+			continue
+		}
+		if got := pred(record); got != tt.want {
+			t.Errorf("parseQualifier(%q) matched %v, want %v", tt.qualifier, got, tt.want)
+		}
+	}
+}
+
+func TestParseQualifierErrors(t *testing.T) {
+	for _, q := range []string{
+		"(id = 7",
+		"(id = 7))",
+		"(id =)",
+		"(id 7)",
+		"(id ~ 7)",
+		"('id' = 7)",
+		"(id = 'open)",
+		"(id = unknown)",
+		"(id like 7)",
+		"(id = 7) and",
+		"not",
+	} {
+		if _, err := parseQualifier(q); err == nil {
+			t.Errorf("parseQualifier(%q) succeeded, want an error", q)
+		}
+	}
+}
@@ -0,0 +1,929 @@
+// Package whdtest provides an in-memory fake of the Web Help Desk REST API, so
+// code built on the whd package can be tested without a real WHD instance.
+//
+//	srv := whdtest.NewServer()
+//	defer srv.Close()
+//
+//	open := srv.AddStatusType("Open")
+//	id := srv.AddTicket(whd.Ticket{Subject: "printer on fire", StatusTypeId: open})
+//
+//	client := srv.Client()
+//	var t whd.Ticket
+//	err := client.GetTicket(ctx, id, &t)
+//
+// The server keeps every record as the JSON object WHD would return, filters
+// list endpoints with qualifiers, pages results with limit and page, and can
+// be told to fail requests with Fail.
+package whdtest
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pvik/go-whd/whd"
+)
+
+const (
+	raPath     = "/helpdesk/WebObjects/Helpdesk.woa/ra/"
+	uploadPath = "/helpdesk/attachment/upload"
+)
+
+// Resource names, as they appear in the REST paths.
+const (
+	Tickets                        = "Tickets"
+	TechNotes                      = "TechNotes"
+	Assets                         = "Assets"
+	Locations                      = "Locations"
+	RequestTypes                   = "RequestTypes"
+	StatusTypes                    = "StatusTypes"
+	PriorityTypes                  = "PriorityTypes"
+	Techs                          = "Techs"
+	Clients                        = "Clients"
+	TechGroups                     = "TechGroups"
+	AssetTypes                     = "AssetTypes"
+	Manufacturers                  = "Manufacturers"
+	Models                         = "Models"
+	AssetStatuses                  = "AssetStatuses"
+	CustomFieldDefinitions         = "CustomFieldDefinitions"
+	LocationCustomFieldDefinitions = "CustomFieldDefinitions/Location"
+	AssetCustomFieldDefinitions    = "CustomFieldDefinitions/Asset"
+)
+
+// resourceTypes holds the "type" WHD stamps on records of each resource.
+var resourceTypes = map[string]string{
+	Tickets:                        "JobTicket",
+	TechNotes:                      "TechNote",
+	Assets:                         "Asset",
+	Locations:                      "Location",
+	RequestTypes:                   "RequestType",
+	StatusTypes:                    "StatusType",
+	PriorityTypes:                  "PriorityType",
+	Techs:                          "Tech",
+	Clients:                        "Client",
+	TechGroups:                     "TechGroup",
+	AssetTypes:                     "AssetType",
+	Manufacturers:                  "Manufacturer",
+	Models:                         "Model",
+	AssetStatuses:                  "AssetStatus",
+	CustomFieldDefinitions:         "CustomFieldDefinition",
+	LocationCustomFieldDefinitions: "CustomFieldDefinition",
+	AssetCustomFieldDefinitions:    "CustomFieldDefinition",
+}
+
+// singular maps the singular path spellings WHD accepts onto their resource.
+var singular = map[string]string{
+	"Ticket":   Tickets,
+	"Location": Locations,
+	"Asset":    Assets,
+	"Tech":     Techs,
+}
+
+// customFieldKeys holds the key custom field values are returned under; WHD
+// accepts them as "customFields" on create and update.
+var customFieldKeys = map[string]string{
+	Tickets:   "ticketCustomFields",
+	Locations: "locationCustomFields",
+	Assets:    "assetCustomFields",
+	Clients:   "clientCustomFields",
+}
+
+// references are the keys of a record pointing at another resource, or at a
+// list of them. They are filled in from the referenced records on write, like
+// WHD does, so qualifiers such as statustype.statusTypeName work.
+var references = map[string]string{
+	"location":       Locations,
+	"statustype":     StatusTypes,
+	"prioritytype":   PriorityTypes,
+	"problemtype":    RequestTypes,
+	"clientReporter": Clients,
+	"clientTech":     Techs,
+	"model":          Models,
+	"manufacturer":   Manufacturers,
+	"assetType":      AssetTypes,
+	"assetStatus":    AssetStatuses,
+	"assets":         Assets,
+}
+
+// softDeleted are the resources WHD flags as deleted instead of removing.
+// List requests leave deleted records out unless the qualifier mentions the
+// deleted flag.
+var softDeleted = map[string]bool{
+	Tickets: true,
+}
+
+// Failure describes requests the Server should fail instead of serving.
+type Failure struct {
+	// Method restricts the failure to one HTTP method. Empty matches any.
+	Method string
+	// Path restricts the failure to paths below the REST root starting with
+	// it, e.g. "Ticket/12" or "Tickets". The attachment upload is matched by
+	// its full path. Empty matches any path.
+	Path string
+	// Status is the HTTP status returned, 500 when zero.
+	Status int
+	// Reason is returned as the WHD "reason".
+	Reason string
+	// Times is the number of requests to fail. Zero fails every matching
+	// request until ClearFailures.
+	Times int
+}
+
+// Request is a request received by the Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	// ContentLength is -1 for a body sent chunked.
+	ContentLength int64
+}
+
+type attachment struct {
+	name string
+	data []byte
+}
+
+// Server is a fake WHD instance listening on a local address. Its fields must
+// not be changed once requests are being made.
+type Server struct {
+	*httptest.Server
+
+	// APIKey, Username and Password are the credentials the Server accepts.
+	APIKey   string
+	Username string
+	Password string
+
+	// ProxyHeaders, when set, must all be present with these values on every
+	// request, as an authenticating reverse proxy in front of WHD would
+	// require. Requests missing one get 407 Proxy Authentication Required.
+	ProxyHeaders http.Header
+
+	mu          sync.Mutex
+	collections map[string]*collection
+	attachments map[int]attachment
+	nextAttID   int
+	sessions    map[string]bool
+	nextSession int
+	failures    []*Failure
+	requests    []Request
+	lastWrite   time.Time
+}
+
+// NewServer starts a fake WHD server. It accepts the API key "whdtest" and the
+// user "admin" with password "admin". The caller must Close it.
+func NewServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func newServer() *Server {
+	return &Server{
+		APIKey:      "whdtest",
+		Username:    "admin",
+		Password:    "admin",
+		collections: make(map[string]*collection),
+		attachments: make(map[int]attachment),
+		sessions:    make(map[string]bool),
+	}
+}
+
+// NewTLSServer is NewServer serving HTTPS with a self-signed certificate,
+// which Client trusts. The certificate is available from Certificate.
+func NewTLSServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// User returns API key credentials accepted by the Server.
+func (s *Server) User() whd.User {
+	return whd.User{Pass: s.APIKey, Type: whd.ApiKeyAuth}
+}
+
+// Client returns a whd.Client for the Server. Retries are off unless opts turn
+// them back on, so injected failures surface immediately. For a TLS Server the
+// Client trusts its certificate.
+func (s *Server) Client(opts ...whd.ClientOption) *whd.Client {
+	defaults := []whd.ClientOption{whd.WithRetryMax(0)}
+	if cert := s.Certificate(); cert != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(cert)
+		defaults = append(defaults, whd.WithRootCAs(pool))
+	}
+	opts = append(defaults, opts...)
+	return whd.NewClient(s.URL, s.User(), opts...)
+}
+
+// Fail makes the Server fail the requests matching f.
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f.Status == 0 {
+		f.Status = http.StatusInternalServerError
+	}
+	s.failures = append(s.failures, &f)
+}
+
+// ClearFailures removes every failure added with Fail.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = nil
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// Sessions returns the number of sessions currently open.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.sessions)
+}
+
+// ExpireSessions ends every open session, as a WHD session timeout would.
+// Requests still using their keys get 401 Unauthorized.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = make(map[string]bool)
+}
+
+// Put stores v, usually a whd type, in resource and returns its id. A zero id
+// in v is replaced by the next free one.
+func (s *Server) Put(resource string, v interface{}) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := toRecord(v)
+	return s.store(resource, record, false)
+}
+
+// Get decodes record id of resource into v, reporting whether it exists.
+func (s *Server) Get(resource string, id int, v interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.collection(resource).records[id]
+	if !ok {
+		return false
+	}
+	data, _ := json.Marshal(record)
+	return json.Unmarshal(data, v) == nil
+}
+
+// AddTicket stores t and returns its id.
+func (s *Server) AddTicket(t whd.Ticket) int {
+	return s.Put(Tickets, t)
+}
+
+// Ticket returns the stored ticket id.
+func (s *Server) Ticket(id int) (whd.Ticket, bool) {
+	var t whd.Ticket
+	ok := s.Get(Tickets, id, &t)
+	return t, ok
+}
+
+// AddAsset stores a and returns its id.
+func (s *Server) AddAsset(a whd.Asset) int {
+	return s.Put(Assets, a)
+}
+
+// AddLocation stores l and returns its id.
+func (s *Server) AddLocation(l whd.Location) int {
+	return s.Put(Locations, l)
+}
+
+// AddRequester stores r and returns its id.
+func (s *Server) AddRequester(r whd.Requester) int {
+	return s.Put(Clients, r)
+}
+
+// AddStatusType stores a status type and returns its id.
+func (s *Server) AddStatusType(name string) int {
+	return s.Put(StatusTypes, whd.StatusType{Name: name})
+}
+
+// AddPriorityType stores a priority type and returns its id.
+func (s *Server) AddPriorityType(name string) int {
+	return s.Put(PriorityTypes, whd.PriorityType{Name: name})
+}
+
+// AddRequestType stores a request type under parentID (0 for none) and
+// returns its id.
+func (s *Server) AddRequestType(name string, parentID int) int {
+	return s.Put(RequestTypes, whd.RequestType{Name: name, ParentId: parentID})
+}
+
+// AddTech stores t and returns its id.
+func (s *Server) AddTech(t whd.Tech) int {
+	return s.Put(Techs, t)
+}
+
+// AddTechGroup stores g and returns its id.
+func (s *Server) AddTechGroup(g whd.TechGroup) int {
+	return s.Put(TechGroups, g)
+}
+
+// AddAssetType stores an asset type and returns its id.
+func (s *Server) AddAssetType(name string) int {
+	return s.Put(AssetTypes, whd.AssetType{Name: name})
+}
+
+// AddManufacturer stores a manufacturer and returns its id.
+func (s *Server) AddManufacturer(name string) int {
+	return s.Put(Manufacturers, whd.Manufacturer{Name: name})
+}
+
+// AddModel stores a model of manufacturerID and assetTypeID and returns its
+// id.
+func (s *Server) AddModel(name string, manufacturerID int, assetTypeID int) int {
+	return s.Put(Models, whd.Model{Name: name, ManufacturerId: manufacturerID, AssetTypeId: assetTypeID})
+}
+
+// AddAssetStatus stores an asset status and returns its id.
+func (s *Server) AddAssetStatus(name string) int {
+	return s.Put(AssetStatuses, whd.AssetStatus{Name: name})
+}
+
+// AddCustomFieldDefinition stores a custom field definition in resource
+// (CustomFieldDefinitions, LocationCustomFieldDefinitions or
+// AssetCustomFieldDefinitions) and returns its id.
+func (s *Server) AddCustomFieldDefinition(resource string, label string) int {
+	return s.Put(resource, map[string]interface{}{"label": label})
+}
+
+// AddNote adds a tech note to ticket ticketID and returns its id.
+func (s *Server) AddNote(ticketID int, text string, hidden bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store(TechNotes, s.newNote(ticketID, text, hidden), false)
+}
+
+// Notes returns the notes of ticket ticketID.
+func (s *Server) Notes(ticketID int) []whd.Note {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []whd.Note
+	for _, record := range s.collection(TechNotes).list(noteFilter(ticketID)) {
+		var n whd.Note
+		data, _ := json.Marshal(record)
+		json.Unmarshal(data, &n)
+		notes = append(notes, n)
+	}
+	return notes
+}
+
+// AddAttachment attaches a file to ticket ticketID and returns its id.
+func (s *Server) AddAttachment(ticketID int, filename string, data []byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _ := s.attach(Tickets, ticketID, filename, data)
+	return id
+}
+
+// Attachment returns the name and content of attachment id.
+func (s *Server) Attachment(id int) (string, []byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	att, ok := s.attachments[id]
+	return att.name, att.data, ok
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, Request{
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Query:         r.URL.Query(),
+		Header:        r.Header.Clone(),
+		ContentLength: r.ContentLength,
+	})
+
+	if f := s.failure(r); f != nil {
+		writeError(w, f.Status, f.Reason)
+		return
+	}
+
+	for name, values := range s.ProxyHeaders {
+		if !slices.Equal(r.Header.Values(name), values) {
+			writeError(w, http.StatusProxyAuthRequired, "Proxy authentication required")
+			return
+		}
+	}
+
+	switch {
+	case r.URL.Path == uploadPath:
+		s.handleUpload(w, r)
+	case strings.HasPrefix(r.URL.Path, raPath):
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "Invalid credentials")
+			return
+		}
+		s.handleAPI(w, r, strings.Trim(strings.TrimPrefix(r.URL.Path, raPath), "/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) failure(r *http.Request) *Failure {
+	rel := strings.TrimPrefix(r.URL.Path, raPath)
+	for i, f := range s.failures {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if f.Path != "" && !strings.HasPrefix(rel, f.Path) && r.URL.Path != f.Path {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i:i], s.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	q := r.URL.Query()
+	switch {
+	case q.Get("apiKey") != "":
+		return q.Get("apiKey") == s.APIKey
+	case q.Get("sessionKey") != "":
+		return s.sessions[q.Get("sessionKey")]
+	case q.Get("username") != "":
+		return q.Get("username") == s.Username && q.Get("password") == s.Password
+	}
+	return false
+}
+
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request, path string) {
+	switch {
+	case path == "Session":
+		s.handleSession(w, r)
+		return
+	case path == "TicketNotes" && r.Method == http.MethodGet:
+		id, _ := strconv.Atoi(r.URL.Query().Get("jobTicketId"))
+		writeList(w, r, s.collection(TechNotes).list(noteFilter(id)))
+		return
+	case path == TechNotes && r.Method == http.MethodPost:
+		s.handleCreateNote(w, r)
+		return
+	case strings.HasPrefix(path, "TicketAttachments/") && r.Method == http.MethodGet:
+		s.handleAttachment(w, strings.TrimPrefix(path, "TicketAttachments/"))
+		return
+	}
+
+	resource, id, ok := splitPath(path)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown resource %s", path))
+		return
+	}
+
+	if id == 0 {
+		s.handleCollection(w, r, resource)
+	} else {
+		s.handleRecord(w, r, resource, id)
+	}
+}
+
+// splitPath splits a path below the REST root into a resource and an optional
+// record id.
+func splitPath(path string) (string, int, bool) {
+	resource := path
+	id := 0
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		if n, err := strconv.Atoi(path[i+1:]); err == nil {
+			resource, id = path[:i], n
+		}
+	}
+
+	if r, ok := singular[resource]; ok {
+		resource = r
+	}
+	if _, ok := resourceTypes[resource]; !ok {
+		return "", 0, false
+	}
+	return resource, id, true
+}
+
+func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request, resource string) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		pred, err := parseQualifier(q.Get("qualifier"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		filter := pred
+		if softDeleted[resource] && !strings.Contains(q.Get("qualifier"), "deleted") {
+			filter = func(record map[string]interface{}) bool {
+				return record["deleted"] != true && pred(record)
+			}
+		}
+		if assetNumber := q.Get("assetNumber"); resource == Assets && assetNumber != "" {
+			base := filter
+			filter = func(record map[string]interface{}) bool {
+				return record["assetNumber"] == assetNumber && base(record)
+			}
+		}
+		writeList(w, r, s.collection(resource).list(filter))
+	case http.MethodPost:
+		record, err := readRecord(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		delete(record, "id")
+		id := s.store(resource, record, false)
+		writeJSON(w, http.StatusCreated, s.collection(resource).records[id])
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s not supported on %s", r.Method, resource))
+	}
+}
+
+func (s *Server) handleRecord(w http.ResponseWriter, r *http.Request, resource string, id int) {
+	existing, ok := s.collection(resource).records[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %d not found", resourceTypes[resource], id))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, existing)
+	case http.MethodPut:
+		record, err := readRecord(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		record["id"] = float64(id)
+		s.store(resource, record, true)
+		writeJSON(w, http.StatusOK, s.collection(resource).records[id])
+	case http.MethodDelete:
+		if softDeleted[resource] {
+			existing["deleted"] = true
+		} else {
+			delete(s.collection(resource).records, id)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s not supported on %s", r.Method, resource))
+	}
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.nextSession++
+		key := fmt.Sprintf("whdtest-session-%d", s.nextSession)
+		s.sessions[key] = true
+		http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: key, Path: "/helpdesk"})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"sessionKey": key})
+	case http.MethodDelete:
+		delete(s.sessions, r.URL.Query().Get("sessionKey"))
+		io.WriteString(w, "OK")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Session supports GET and DELETE")
+	}
+}
+
+func (s *Server) handleCreateNote(w http.ResponseWriter, r *http.Request) {
+	var note whd.Note
+	if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := s.collection(Tickets).records[note.JobTicket.Id]; !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("JobTicket %d not found", note.JobTicket.Id))
+		return
+	}
+
+	id := s.store(TechNotes, s.newNote(note.JobTicket.Id, note.NoteText, note.IsHidden), false)
+	writeJSON(w, http.StatusCreated, s.collection(TechNotes).records[id])
+}
+
+func (s *Server) newNote(ticketID int, text string, hidden bool) map[string]interface{} {
+	return map[string]interface{}{
+		"date":           time.Now().UTC().Format(time.RFC3339),
+		"noteText":       text,
+		"mobileNoteText": text,
+		"isHidden":       hidden,
+		"isTechNote":     true,
+		"jobticket":      map[string]interface{}{"id": float64(ticketID), "type": "JobTicket"},
+	}
+}
+
+func noteFilter(ticketID int) predicate {
+	return func(record map[string]interface{}) bool {
+		ticket, _ := record["jobticket"].(map[string]interface{})
+		return ticket != nil && idOf(ticket["id"]) == ticketID
+	}
+}
+
+func (s *Server) handleAttachment(w http.ResponseWriter, idStr string) {
+	id, _ := strconv.Atoi(idStr)
+	att, ok := s.attachments[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Attachment %s not found", idStr))
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(att.name))
+	if contentType == "" {
+		contentType = http.DetectContentType(att.data)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(att.data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.name}))
+	w.Write(att.data)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "upload needs POST")
+		return
+	}
+	if !s.sessions[q.Get("sessionKey")] {
+		writeError(w, http.StatusUnauthorized, "Invalid session")
+		return
+	}
+
+	var resource string
+	switch q.Get("type") {
+	case "jobTicket":
+		resource = Tickets
+	case "techNote":
+		resource = TechNotes
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"reason": fmt.Sprintf("Unknown entity type %q", q.Get("type"))})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"reason": "No file in upload"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entityID, _ := strconv.Atoi(q.Get("entityId"))
+	id, ok := s.attach(resource, entityID, header.Filename, data)
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"reason": fmt.Sprintf("%s %d not found", q.Get("type"), entityID)})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id})
+}
+
+// attach stores an attachment and lists it on the record it belongs to.
+func (s *Server) attach(resource string, id int, filename string, data []byte) (int, bool) {
+	record, ok := s.collection(resource).records[id]
+	if !ok {
+		return 0, false
+	}
+
+	s.nextAttID++
+	s.attachments[s.nextAttID] = attachment{name: filename, data: data}
+
+	atts, _ := record["attachments"].([]interface{})
+	record["attachments"] = append(atts, map[string]interface{}{
+		"id":            float64(s.nextAttID),
+		"type":          "TicketAttachment",
+		"fileName":      filename,
+		"sizeString":    fmt.Sprintf("%d bytes", len(data)),
+		"uploadDateUtc": time.Now().UTC().Format(time.RFC3339),
+	})
+	return s.nextAttID, true
+}
+
+// store saves record in resource, merging it into the existing record when
+// merge is set, and returns its id.
+func (s *Server) store(resource string, record map[string]interface{}, merge bool) int {
+	c := s.collection(resource)
+
+	id := idOf(record["id"])
+	if id == 0 {
+		c.nextID++
+		id = c.nextID
+	} else if id > c.nextID {
+		c.nextID = id
+	}
+
+	if key, ok := customFieldKeys[resource]; ok {
+		if cfs, ok := record["customFields"]; ok {
+			record[key] = cfs
+			delete(record, "customFields")
+		}
+	}
+
+	if existing, ok := c.records[id]; ok && merge {
+		for k, v := range record {
+			if k == customFieldKeys[resource] {
+				v = mergeCustomFields(existing[k], v)
+			}
+			existing[k] = v
+		}
+		record = existing
+	}
+
+	for key, ref := range references {
+		var objs []interface{}
+		switch v := record[key].(type) {
+		case map[string]interface{}:
+			objs = []interface{}{v}
+		case []interface{}:
+			objs = v
+		}
+		for _, o := range objs {
+			obj, ok := o.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if target, ok := s.collection(ref).records[idOf(obj["id"])]; ok {
+				for k, v := range target {
+					obj[k] = v
+				}
+			}
+		}
+	}
+
+	// WHD stamps lastUpdated with second precision; keep the stamps strictly
+	// increasing so quick successive writes can still be told apart
+	if _, ok := customFieldKeys[resource]; ok {
+		now := time.Now().UTC().Truncate(time.Second)
+		if !now.After(s.lastWrite) {
+			now = s.lastWrite.Add(time.Second)
+		}
+		s.lastWrite = now
+		record["lastUpdated"] = now.Format(time.RFC3339)
+	}
+
+	record["id"] = float64(id)
+	record["type"] = resourceTypes[resource]
+	c.records[id] = record
+	return id
+}
+
+// mergeCustomFields updates the stored custom field values with the ones
+// sent, keyed by definitionId.
+func mergeCustomFields(existing interface{}, sent interface{}) interface{} {
+	merged, _ := existing.([]interface{})
+	merged = append([]interface{}(nil), merged...)
+	updates, _ := sent.([]interface{})
+
+	for _, u := range updates {
+		um, _ := u.(map[string]interface{})
+		found := false
+		for i, e := range merged {
+			em, _ := e.(map[string]interface{})
+			if em != nil && um != nil && idOf(em["definitionId"]) == idOf(um["definitionId"]) {
+				merged[i] = um
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, u)
+		}
+	}
+	return merged
+}
+
+func (s *Server) collection(resource string) *collection {
+	c, ok := s.collections[resource]
+	if !ok {
+		c = &collection{records: make(map[int]map[string]interface{})}
+		s.collections[resource] = c
+	}
+	return c
+}
+
+type collection struct {
+	nextID  int
+	records map[int]map[string]interface{}
+}
+
+// list returns the records matching filter, ordered by id.
+func (c *collection) list(filter predicate) []map[string]interface{} {
+	ids := make([]int, 0, len(c.records))
+	for id := range c.records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	out := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		if filter == nil || filter(c.records[id]) {
+			out = append(out, c.records[id])
+		}
+	}
+	return out
+}
+
+func toRecord(v interface{}) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("whdtest: cannot marshal %T: %s", v, err))
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		panic(fmt.Sprintf("whdtest: %T is not a JSON object", v))
+	}
+	return record
+}
+
+func readRecord(r *http.Request) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		return nil, fmt.Errorf("Invalid JSON: %s", err)
+	}
+	return record, nil
+}
+
+func idOf(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+// writeList writes the page of records selected by the limit and page query
+// parameters, defaulting to WHD's 25 items from page 1.
+func writeList(w http.ResponseWriter, r *http.Request, records []map[string]interface{}) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 25
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	start := (page - 1) * limit
+	if start > len(records) {
+		start = len(records)
+	}
+	end := start + limit
+	if end > len(records) {
+		end = len(records)
+	}
+	writeJSON(w, http.StatusOK, records[start:end])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, reason string) {
+	writeJSON(w, status, map[string]interface{}{"reason": reason})
+}
@@ -0,0 +1,170 @@
+package whdtest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/pvik/go-whd/whd"
+	"github.com/pvik/go-whd/whd/whdtest"
+)
+
+func TestServerPaging(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	for i := 1; i <= 7; i++ {
+		srv.AddTicket(whd.Ticket{Subject: fmt.Sprintf("ticket %d", i)})
+	}
+	c := srv.Client(whd.WithLogger(nil))
+
+	tests := []struct {
+		limit, page uint
+		want        []int
+	}{
+		{3, 1, []int{1, 2, 3}},
+		{3, 2, []int{4, 5, 6}},
+		{3, 3, []int{7}},
+		{3, 4, nil},
+		{10, 1, []int{1, 2, 3, 4, 5, 6, 7}},
+		{0, 0, []int{1, 2, 3, 4, 5, 6, 7}},
+	}
+
+	for _, tt := range tests {
+		var tickets []whd.Ticket
+		if err := c.GetTickets(context.Background(), "", tt.limit, tt.page, &tickets); err != nil {
+			t.Fatalf("limit %d page %d: %v", tt.limit, tt.page, err)
+		}
+		got := make([]int, 0, len(tickets))
+		for _, tk := range tickets {
+			got = append(got, tk.Id)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("limit %d page %d: got ids %v, want %v", tt.limit, tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestServerDefaultPageSize(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	for i := 0; i < 30; i++ {
+		srv.AddTicket(whd.Ticket{Subject: "s"})
+	}
+
+	var tickets []whd.Ticket
+	c := srv.Client(whd.WithLogger(nil))
+	if err := c.GetTickets(context.Background(), "", 0, 1, &tickets); err != nil {
+		t.Fatal(err)
+	}
+	if len(tickets) != 25 {
+		t.Errorf("got %d tickets, want WHD's default of 25", len(tickets))
+	}
+}
+
+func TestServerListsSkipDeleted(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	srv.AddTicket(whd.Ticket{Subject: "live"})
+	srv.AddTicket(whd.Ticket{Subject: "gone", Deleted: true})
+	c := srv.Client(whd.WithLogger(nil))
+
+	tests := []struct {
+		qualifier string
+		want      int
+	}{
+		{"", 1},
+		{"(subject like '*')", 1},
+		{"(deleted = 1)", 1},
+		{"(deleted = 1) or (deleted = null)", 2},
+	}
+
+	for _, tt := range tests {
+		var tickets []whd.Ticket
+		if err := c.GetTickets(context.Background(), tt.qualifier, 10, 1, &tickets); err != nil {
+			t.Fatalf("%q: %v", tt.qualifier, err)
+		}
+		if len(tickets) != tt.want {
+			t.Errorf("%q: got %d tickets, want %d", tt.qualifier, len(tickets), tt.want)
+		}
+	}
+}
+
+func TestServerFail(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		failure whdtest.Failure
+		// outcome of GET Ticket/1, POST Tickets and GET Ticket/1 again;
+		// 0 is success
+		want [3]int
+	}{
+		{"every request", whdtest.Failure{}, [3]int{500, 500, 500}},
+		{"once", whdtest.Failure{Times: 1}, [3]int{500, 0, 0}},
+		{"twice", whdtest.Failure{Times: 2, Status: 503}, [3]int{503, 503, 0}},
+		{"by method", whdtest.Failure{Method: http.MethodPost, Status: 400}, [3]int{0, 400, 0}},
+		{"by path", whdtest.Failure{Path: "Ticket/1", Status: 404}, [3]int{404, 0, 404}},
+		{"other path", whdtest.Failure{Path: "Assets"}, [3]int{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := whdtest.NewServer()
+			defer srv.Close()
+
+			id := srv.AddTicket(whd.Ticket{Subject: "s"})
+			c := srv.Client(whd.WithLogger(nil))
+			srv.Fail(tt.failure)
+
+			var ticket whd.Ticket
+			errs := [3]error{
+				c.GetTicket(ctx, id, &ticket),
+				func() error { _, err := c.CreateUpdateTicket(ctx, whd.Ticket{Subject: "new"}); return err }(),
+				c.GetTicket(ctx, id, &ticket),
+			}
+
+			for i, err := range errs {
+				got := 0
+				var apiErr *whd.APIError
+				if errors.As(err, &apiErr) {
+					got = apiErr.StatusCode
+				} else if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+				if got != tt.want[i] {
+					t.Errorf("request %d: got status %d, want %d", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServerClearFailures(t *testing.T) {
+	srv := whdtest.NewServer()
+	defer srv.Close()
+
+	id := srv.AddTicket(whd.Ticket{Subject: "s"})
+	c := srv.Client(whd.WithLogger(nil))
+	srv.Fail(whdtest.Failure{Reason: "boom"})
+
+	var ticket whd.Ticket
+	err := c.GetTicket(context.Background(), id, &ticket)
+	var apiErr *whd.APIError
+	if !errors.As(err, &apiErr) || apiErr.Reason != "boom" {
+		t.Fatalf("got %v, want the injected failure", err)
+	}
+
+	srv.ClearFailures()
+	if err := c.GetTicket(context.Background(), id, &ticket); err != nil {
+		t.Fatalf("after ClearFailures: %v", err)
+	}
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("got %d requests recorded, want 2", n)
+	}
+}